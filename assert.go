@@ -4,21 +4,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
+	"strings"
 )
 
-// DefaultDiffLength is the default number of bytes that will be returned in a
-// diff. Right now this is only respected for the request Body diff, but may
-// expand to others in the future.
+// DefaultDiffLength is the number of bytes of a value that will be quoted in a
+// mismatch; whole bodies are shown as a diff instead, which is configured with
+// DiffContext and DiffMaxHunks.
 const DefaultDiffLength = 76
 
 // Responses is an array of Response pointers
 type Responses []*Response
 
+// Assertion is a check over a set of responses, such as the method expression
+// `Responses.StatusSame`; it returns an error when the check fails. The
+// assertions on Responses fail with a MismatchError, which ends with curl
+// commands that reproduce the request against each server.
+type Assertion func(Responses) error
+
 // StatusSame verifies that all responses have the same status codes; returns
 // an error for the first mismatch, if not.
-func (r Responses) StatusSame() error {
+func (r Responses) StatusSame() (err error) {
+	defer r.reproducible(&err)
+
 	if len(r) < 1 {
 		return nil
 	}
@@ -28,7 +35,9 @@ func (r Responses) StatusSame() error {
 
 // StatusEqual verifies that all responses match a given status code; returns an
 // error for the first mismatch, if not.
-func (r Responses) StatusEqual(status int) error {
+func (r Responses) StatusEqual(status int) (err error) {
+	defer r.reproducible(&err)
+
 	for i := range r {
 		if r[i].StatusCode != status {
 			return fmt.Errorf(
@@ -45,7 +54,9 @@ func (r Responses) StatusEqual(status int) error {
 
 // HeaderSame verifies that all headers match for all responses; returns an
 // error for the first mismatch, if not.
-func (r Responses) HeaderSame() error {
+func (r Responses) HeaderSame() (err error) {
+	defer r.reproducible(&err)
+
 	if len(r) < 1 {
 		return nil
 	}
@@ -64,7 +75,9 @@ func (r Responses) HeaderSame() error {
 
 // HeaderEqual verifies that a single header of key `k` matches the value `v`;
 // value is expected to be either a `string` or `[]string`.
-func (r Responses) HeaderEqual(k string, v interface{}) error {
+func (r Responses) HeaderEqual(k string, v interface{}) (err error) {
+	defer r.reproducible(&err)
+
 	switch v.(type) {
 	case []string:
 		return r.headerEqualWithArrayValue(k, v.([]string))
@@ -117,66 +130,164 @@ func (r Responses) headerEqualWithArrayValue(k string, v []string) error {
 	return nil
 }
 
+// ContentEncodingSame verifies that all servers chose the same
+// `Content-Encoding`; a missing header is treated as "identity". Bodies are
+// decoded before any other comparison, so this is the only assertion that will
+// notice one server compressing and another not. gzip, deflate and br are
+// decoded out of the box; other codings need a decoder added with
+// RegisterDecoder.
+func (r Responses) ContentEncodingSame() (err error) {
+	defer r.reproducible(&err)
+
+	if len(r) < 2 {
+		return nil
+	}
+
+	expected := contentEncoding(r[0])
+	for _, resp := range r[1:] {
+		if enc := contentEncoding(resp); enc != expected {
+			return fmt.Errorf(
+				"(%s)%s: Content-Encoding was %q, expected %q",
+				resp.Request.Method, resp.Request.URL, enc, expected)
+		}
+	}
+
+	return nil
+}
+
+func contentEncoding(resp *Response) string {
+	if resp.Headers == nil {
+		return "identity"
+	}
+
+	codings := contentCodings(resp.Headers.Get("Content-Encoding"))
+	if len(codings) == 0 {
+		return "identity"
+	}
+
+	return strings.Join(codings, ", ")
+}
+
 // BodySame verifies that the response body was identical on all requests;
 // returns an error for the first mismatch if not. This is a bytewise
 // comparison.
-// When an error occurs, the response bodies will be trimmed to
-// `DefaultDiffLength`, but this can be overridden by setting the environment
-// variable `CONGRUENT_MAX_DIFF` to an integer value.
-func (r Responses) BodySame() error {
-	if len(r) < 2 {
-		return nil
+// When an error occurs, it includes a unified diff of the two bodies, with JSON
+// pretty-printed first; BodySameWith configures the diff.
+func (r Responses) BodySame() (err error) {
+	defer r.reproducible(&err)
+
+	return r.BodySameWith()
+}
+
+// BodySameWith is BodySame, with the diff in its error configured by options
+// such as DiffContext and DiffMaxHunks.
+func (r Responses) BodySameWith(opts ...ContentOption) (err error) {
+	defer r.reproducible(&err)
+
+	c, err := newContentConfig(opts)
+	if err != nil {
+		return err
 	}
 
-	for i, resp := range r[1:] {
-		if !bytesEqual(resp.Body, r[i].Body) {
+	for i := 1; i < len(r); i++ {
+		prev, resp := r[i-1], r[i]
+		if !bytesEqual(resp.Body, prev.Body) {
 			return fmt.Errorf(
-				"(%s)%s:\nExpected body:\n  %s\nReceived body: \n  %s",
-				resp.Request.Method, resp.Request.URL, cutBody(r[i].Body), cutBody(resp.Body))
+				"(%s)%s: Body differed\n%s",
+				resp.Request.Method, resp.Request.URL, responsesDiff(c, prev, resp, prev.Body, resp.Body))
 		}
 	}
 
 	return nil
 }
 
+// responsesDiff diffs two bodies, labelling them by the servers they came from
+func responsesDiff(c *contentConfig, prev, resp *Response, a, b []byte) string {
+	from, to := responseServer(prev), responseServer(resp)
+	if from == to {
+		from, to = "expected", "received"
+	}
+
+	return bodyDiff(c, a, b, from, to)
+}
+
 // BodyContentSame ensures that response bodies are roughly equivalent JSON or
 // strings; no other content types can be expected to be handled appropriately.
-// In here, JSON is Unmarshal'd, Marshal'd, and then compared. This results in
-// only the contents being taken into account, and things like newlines,
-// indentation, and etc being ignored.
-func (r Responses) BodyContentSame() error {
-	var bodies [][]byte
-
-	for i, resp := range r {
-		var body interface{}
-		if resp.Body == nil {
-			bodies = append(bodies, []byte{})
-			continue
-		}
+// In here, JSON is Unmarshal'd and then compared field by field. This results
+// in only the contents being taken into account, and things like newlines,
+// indentation, and etc being ignored. Numbers are compared exactly, by decimal
+// value, so large IDs are never rounded, and `1` equals `1.0`. The comparison
+// can be adjusted by passing ContentOptions, such as IgnorePaths,
+// AbsoluteTolerance or DistinguishIntegers.
+func (r Responses) BodyContentSame(opts ...ContentOption) (err error) {
+	defer r.reproducible(&err)
+
+	c, err := newContentConfig(opts)
+	if err != nil {
+		return err
+	}
 
-		if err := json.Unmarshal(resp.Body, &body); err != nil {
-			// hacky: if unmarshalling fails, treat as a string
-			fmt.Println(err)
-			bodies = append(bodies, resp.Body)
+	for i := 1; i < len(r); i++ {
+		prev, resp := r[i-1], r[i]
+
+		a, aok := decodeContent(prev.Body)
+		b, bok := decodeContent(resp.Body)
+		if aok && bok {
+			if m := compareContent(c, nil, a, b); m != nil {
+				return fmt.Errorf(
+					"(%s)%s: %s\n%s",
+					resp.Request.Method, resp.Request.URL, m, responsesDiff(c, prev, resp, prev.Body, resp.Body))
+			}
 			continue
 		}
 
-		b, err := json.Marshal(body)
+		na, err := normalizeContent(prev.Body)
 		if err != nil {
 			return err
 		}
-		bodies = append(bodies, b)
-
-		if i > 0 && !bytesEqual(b, bodies[i-1]) {
+		nb, err := normalizeContent(resp.Body)
+		if err != nil {
+			return err
+		}
+		if !bytesEqual(na, nb) {
 			return fmt.Errorf(
-				"(%s)%s:\nExpected body:\n  %s\nReceived body: \n  %s",
-				r[i-1].Request.Method, r[i-1].Request.URL, cutBody(bodies[i-1]), cutBody(b))
+				"(%s)%s: Body differed\n%s",
+				resp.Request.Method, resp.Request.URL, responsesDiff(c, prev, resp, na, nb))
 		}
 	}
 
 	return nil
 }
 
+// normalizeContent re-marshals JSON so that only its contents matter; anything
+// that fails to unmarshal is returned untouched and compared as a string.
+func normalizeContent(b []byte) ([]byte, error) {
+	if b == nil {
+		return []byte{}, nil
+	}
+
+	var content interface{}
+	if err := unmarshalNumbers(b, &content); err != nil {
+		return b, nil
+	}
+
+	return json.Marshal(content)
+}
+
+// contentEqual compares two bodies as BodyContentSame does with no options:
+// field by field if both are JSON, and byte for byte otherwise
+func contentEqual(a, b []byte) bool {
+	ca, aok := decodeContent(a)
+	cb, bok := decodeContent(b)
+	if !aok || !bok {
+		return bytesEqual(a, b)
+	}
+
+	c, _ := newContentConfig(nil)
+
+	return compareContent(c, nil, ca, cb) == nil
+}
+
 func bytesEqual(b, o []byte) bool {
 	if len(b) != len(o) {
 		return false
@@ -192,14 +303,11 @@ func bytesEqual(b, o []byte) bool {
 }
 
 func cutBody(b []byte) []byte {
-	lstr := os.Getenv("CONGRUENT_MAX_DIFF")
-	l, err := strconv.Atoi(lstr)
-	if err != nil {
-		l = DefaultDiffLength
-	}
-
+	l := DefaultDiffLength
 	if len(b) > l {
-		nb := b[:l]
+		// copy, so that the caller's body isn't overwritten by the ellipsis
+		nb := make([]byte, l, l+3)
+		copy(nb, b)
 		nb = append(nb, '.', '.', '.')
 
 		return nb
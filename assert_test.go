@@ -3,10 +3,34 @@ package congruent
 import (
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 )
 
+// mockResponses makes a 200 response for each body, each from a server of its
+// own: http://server0/, http://server1/ and so on
+func mockResponses(bodies ...string) Responses {
+	var r Responses
+	for i, body := range bodies {
+		u, _ := url.Parse("http://server" + strconv.Itoa(i) + "/")
+		r = append(r, &Response{Request: &http.Request{Method: "GET", URL: u}, Body: []byte(body), StatusCode: 200})
+	}
+
+	return r
+}
+
+// mockStatuses is as mockResponses, but with empty bodies and each status in
+// turn
+func mockStatuses(codes ...int) Responses {
+	r := mockResponses(make([]string, len(codes))...)
+	for i, code := range codes {
+		r[i].StatusCode = code
+	}
+
+	return r
+}
+
 func TestStatus(t *testing.T) {
 	gu, err := url.Parse("http://localhost/")
 	if err != nil {
@@ -22,9 +46,9 @@ func TestStatus(t *testing.T) {
 	mockBadReq := &http.Request{Method: "GET", URL: bu}
 
 	responses := Responses{
-		&Response{mockReq, nil, nil, 200},
-		&Response{mockReq, nil, nil, 200},
-		&Response{mockReq, nil, nil, 200}}
+		&Response{Request: mockReq, StatusCode: 200},
+		&Response{Request: mockReq, StatusCode: 200},
+		&Response{Request: mockReq, StatusCode: 200}}
 
 	if err := responses.StatusEqual(200); err != nil {
 		t.Error(err)
@@ -37,9 +61,9 @@ func TestStatus(t *testing.T) {
 	}
 
 	responses = Responses{
-		&Response{mockReq, nil, nil, 200},
-		&Response{mockBadReq, nil, nil, 201},
-		&Response{mockReq, nil, nil, 200}}
+		&Response{Request: mockReq, StatusCode: 200},
+		&Response{Request: mockBadReq, StatusCode: 201},
+		&Response{Request: mockReq, StatusCode: 200}}
 
 	if err := responses.StatusEqual(200); err == nil {
 		t.Error("Expected error, but got none!")
@@ -74,18 +98,18 @@ func TestBodySame(t *testing.T) {
 	mockBadReq := &http.Request{Method: "GET", URL: bu}
 
 	responses := Responses{
-		&Response{mockReq, nil, []byte{'a', 'b', 'c'}, 200},
-		&Response{mockReq, nil, []byte{'a', 'b', 'c'}, 200},
-		&Response{mockReq, nil, []byte{'a', 'b', 'c'}, 200}}
+		&Response{Request: mockReq, Body: []byte{'a', 'b', 'c'}, StatusCode: 200},
+		&Response{Request: mockReq, Body: []byte{'a', 'b', 'c'}, StatusCode: 200},
+		&Response{Request: mockReq, Body: []byte{'a', 'b', 'c'}, StatusCode: 200}}
 
 	if err := responses.BodySame(); err != nil {
 		t.Error(err)
 	}
 
 	responses = Responses{
-		&Response{mockReq, nil, []byte{'a', 'b', 'c'}, 200},
-		&Response{mockBadReq, nil, []byte{'a', 'b', 'd'}, 200},
-		&Response{mockReq, nil, []byte{'a', 'b', 'c'}, 200}}
+		&Response{Request: mockReq, Body: []byte{'a', 'b', 'c'}, StatusCode: 200},
+		&Response{Request: mockBadReq, Body: []byte{'a', 'b', 'd'}, StatusCode: 200},
+		&Response{Request: mockReq, Body: []byte{'a', 'b', 'c'}, StatusCode: 200}}
 
 	if err := responses.BodySame(); err == nil {
 		t.Error("Expected error, but got none!")
@@ -117,20 +141,62 @@ func TestBodyContentSame(t *testing.T) {
 	mockBadReq := &http.Request{Method: "GET", URL: bu}
 
 	responses := Responses{
-		&Response{mockReq, nil, gs1, 200},
-		&Response{mockReq, nil, gs2, 200},
-		&Response{mockReq, nil, gs1, 200}}
+		&Response{Request: mockReq, Body: gs1, StatusCode: 200},
+		&Response{Request: mockReq, Body: gs2, StatusCode: 200},
+		&Response{Request: mockReq, Body: gs1, StatusCode: 200}}
 
 	if err := responses.BodyContentSame(); err != nil {
 		t.Error(err)
 	}
 
 	responses = Responses{
-		&Response{mockReq, nil, gs2, 200},
-		&Response{mockBadReq, nil, bs1, 200},
-		&Response{mockReq, nil, gs2, 200}}
+		&Response{Request: mockReq, Body: gs2, StatusCode: 200},
+		&Response{Request: mockBadReq, Body: bs1, StatusCode: 200},
+		&Response{Request: mockReq, Body: gs2, StatusCode: 200}}
 
 	if err := responses.BodyContentSame(); err == nil {
 		t.Error("Expected error, but got none!")
 	}
 }
+
+func TestContentEncodingSame(t *testing.T) {
+	gu, err := url.Parse("http://localhost/")
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+
+	mockReq := &http.Request{Method: "GET", URL: gu}
+	gzipped := &http.Header{"Content-Encoding": []string{"gzip"}}
+	identity := &http.Header{"Content-Encoding": []string{"identity"}}
+
+	responses := Responses{
+		&Response{Request: mockReq, Headers: &http.Header{}, StatusCode: 200},
+		&Response{Request: mockReq, Headers: identity, StatusCode: 200}}
+
+	if err := responses.ContentEncodingSame(); err != nil {
+		t.Error(err)
+	}
+
+	responses = Responses{
+		&Response{Request: mockReq, Headers: gzipped, StatusCode: 200},
+		&Response{Request: mockReq, Headers: identity, StatusCode: 200}}
+
+	if err := responses.ContentEncodingSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "gzip") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestCutBodyKeepsOriginal(t *testing.T) {
+	b := []byte(strings.Repeat("a", DefaultDiffLength*2))
+	expected := string(b)
+
+	if cut := cutBody(b); len(cut) != DefaultDiffLength+3 {
+		t.Errorf("expected length %d, got %d", DefaultDiffLength+3, len(cut))
+	}
+	if string(b) != expected {
+		t.Error("expected original body not to be modified")
+	}
+}
@@ -0,0 +1,143 @@
+package congruent
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Check sends a request to all servers in a subtest named for it, and runs
+// every assertion against the responses, reporting each one which fails rather
+// than only the first. With no assertions, the servers must agree on status and
+// body content. Failures are followed by curl commands which reproduce the
+// request against each server, and when the test is run with `-v`, by a dump
+// of the request and every response. It returns whether the subtest passed.
+func Check(t *testing.T, s Servers, r *Request, assertions ...Assertion) bool {
+	t.Helper()
+
+	return t.Run(r.testName(), func(t *testing.T) {
+		t.Helper()
+		check(t, s, r, assertions, testing.Verbose())
+	})
+}
+
+// CheckParallel is Check, but the subtest runs in parallel with the other
+// parallel subtests of t
+func CheckParallel(t *testing.T, s Servers, r *Request, assertions ...Assertion) bool {
+	t.Helper()
+
+	return t.Run(r.testName(), func(t *testing.T) {
+		t.Helper()
+		t.Parallel()
+		check(t, s, r, assertions, testing.Verbose())
+	})
+}
+
+// Check runs Check for every request
+func (rs Requests) Check(t *testing.T, s Servers, assertions ...Assertion) bool {
+	t.Helper()
+
+	passed := true
+	for _, r := range rs {
+		passed = Check(t, s, r, assertions...) && passed
+	}
+
+	return passed
+}
+
+// CheckParallel runs CheckParallel for every request, so that the subtests run
+// in parallel with each other. They finish after the calling test function
+// returns, so the result only reflects failures from before that.
+func (rs Requests) CheckParallel(t *testing.T, s Servers, assertions ...Assertion) bool {
+	t.Helper()
+
+	passed := true
+	for _, r := range rs {
+		passed = CheckParallel(t, s, r, assertions...) && passed
+	}
+
+	return passed
+}
+
+// testName names the subtest for a request; `testing` takes care of making it
+// unique and safe to use with `-run`
+func (r Request) testName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+
+	return r.Method + " " + r.Path
+}
+
+// reporter is the part of testing.T that check uses
+type reporter interface {
+	Helper()
+	Error(args ...interface{})
+	Log(args ...interface{})
+}
+
+func check(t reporter, s Servers, r *Request, assertions []Assertion, verbose bool) {
+	t.Helper()
+
+	if len(assertions) == 0 {
+		assertions = defaultAssertions()
+	}
+
+	responses, err := s.Request(r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	failed := false
+	for _, a := range assertions {
+		if err := a(responses); err != nil {
+			t.Error(withoutReproduction(err))
+			failed = true
+		}
+	}
+
+	if !failed {
+		return
+	}
+	t.Log(reproduce(responses))
+	if verbose {
+		t.Log(dumpExchange(r, responses))
+	}
+}
+
+// dumpExchange renders the request as it was sent to each server, along with
+// the server's response, close to how they were on the wire
+func dumpExchange(r *Request, responses Responses) string {
+	var b strings.Builder
+
+	for _, resp := range responses {
+		req := resp.Request
+		body, _ := requestBody(req)
+		fmt.Fprintf(&b, "\n> %s %s %s\n", req.Method, req.URL.RequestURI(), "HTTP/1.1")
+		fmt.Fprintf(&b, "> Host: %s\n", req.URL.Host)
+		dumpHeaders(&b, "> ", req.Header)
+		if len(body) > 0 {
+			fmt.Fprintf(&b, ">\n%s\n", body)
+		}
+
+		fmt.Fprintf(&b, "< %d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+		if resp.Headers != nil {
+			dumpHeaders(&b, "< ", *resp.Headers)
+		}
+		if len(resp.Body) > 0 {
+			fmt.Fprintf(&b, "<\n%s\n", resp.Body)
+		}
+	}
+
+	return b.String()
+}
+
+func dumpHeaders(b *strings.Builder, prefix string, h http.Header) {
+	for _, k := range sortedHeaderKeys(h) {
+		for _, v := range h[k] {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, k, v)
+		}
+	}
+}
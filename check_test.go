@@ -0,0 +1,118 @@
+package congruent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type testReporter struct {
+	errors []string
+	logs   []string
+}
+
+func (r *testReporter) Helper() {}
+
+func (r *testReporter) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *testReporter) Log(args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprint(args...))
+}
+
+func checkServers(t *testing.T, teapot bool) Servers {
+	handler := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Path", r.URL.Path)
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"ok":true}`)
+		}
+	}
+
+	ts0 := httptest.NewServer(handler(200))
+	t.Cleanup(ts0.Close)
+	status := 200
+	if teapot {
+		status = 418
+	}
+	ts1 := httptest.NewServer(handler(status))
+	t.Cleanup(ts1.Close)
+
+	return Servers{NewServer(ts0.URL, nil), NewServer(ts1.URL, nil)}
+}
+
+func TestCheck(t *testing.T) {
+	servers := checkServers(t, false)
+
+	if !Check(t, servers, NewRequest("GET", "/words", nil, nil)) {
+		t.Error("expected the subtest to pass")
+	}
+
+	requests := Requests{NewRequest("GET", "/a", nil, nil), NewRequest("POST", "/b", nil, "body")}
+	if !requests.Check(t, servers, Responses.StatusSame, Responses.HeaderSame) {
+		t.Error("expected the subtests to pass")
+	}
+
+	for _, p := range []string{"/c", "/d"} {
+		CheckParallel(t, servers, NewRequest("GET", p, nil, nil))
+	}
+}
+
+func TestRequestsCheckParallel(t *testing.T) {
+	servers := checkServers(t, false)
+	requests := Requests{NewRequest("GET", "/a", nil, nil), NewRequest("GET", "/b", nil, nil)}
+
+	// parallel subtests only start once their parent's function has returned
+	var returned, early int32
+	t.Run("group", func(t *testing.T) {
+		requests.CheckParallel(t, servers, func(r Responses) error {
+			if atomic.LoadInt32(&returned) == 0 {
+				atomic.AddInt32(&early, 1)
+			}
+			return r.StatusSame()
+		})
+		atomic.StoreInt32(&returned, 1)
+	})
+
+	if early != 0 {
+		t.Errorf("expected every subtest to run in parallel, %d did not", early)
+	}
+}
+
+func TestCheckReportsEveryFailure(t *testing.T) {
+	servers := checkServers(t, true)
+	req := NewRequest("POST", "/words", &http.Header{"X-Test": {"1"}}, "hello")
+
+	r := &testReporter{}
+	check(r, servers, req, []Assertion{Responses.StatusSame, Responses.BodySame, Responses.StatusSame}, true)
+
+	if len(r.errors) != 2 {
+		t.Errorf("expected 2 errors, got %v", r.errors)
+	}
+	if len(r.logs) != 2 {
+		t.Fatalf("expected curl commands and a dump, got %v", r.logs)
+	}
+
+	for _, server := range servers {
+		cmd := "curl -X POST " + server.BaseURI + "/words -H 'X-Test: 1' --data-raw hello"
+		if !strings.Contains(r.logs[0], cmd) {
+			t.Errorf("expected curl command %q, got:\n%s", cmd, r.logs[0])
+		}
+	}
+
+	for _, s := range []string{"> POST /words HTTP/1.1", "> X-Test: 1", ">\nhello\n", "< 418 I'm a teapot", "< X-Path: /words", "<\n{\"ok\":true}"} {
+		if !strings.Contains(r.logs[1], s) {
+			t.Errorf("expected dump to contain %q, got:\n%s", s, r.logs[1])
+		}
+	}
+
+	r = &testReporter{}
+	check(r, servers, req, []Assertion{Responses.StatusSame}, false)
+	if len(r.errors) != 1 || len(r.logs) != 1 || !strings.HasPrefix(r.logs[0], "reproduce with:") {
+		t.Errorf("expected only an error and curl commands without -v, got %v %v", r.errors, r.logs)
+	}
+}
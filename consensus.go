@@ -0,0 +1,159 @@
+package congruent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConsensusGroup is a set of responses which are all equivalent to each other
+type ConsensusGroup struct {
+	Responses Responses
+	// Err is why this group's answer differs from the majority's, if there is
+	// a majority and this isn't it
+	Err error
+}
+
+// Servers names the servers which gave this group's answer
+func (g ConsensusGroup) Servers() []string {
+	var names []string
+	for _, resp := range g.Responses {
+		names = append(names, responseServer(resp))
+	}
+
+	return names
+}
+
+// Consensus is the responses grouped by equivalent answer, largest group
+// first; groups of the same size keep the order of their first server
+type Consensus struct {
+	Groups []ConsensusGroup
+	total  int
+}
+
+// Majority returns the group which more than half of the servers agree with,
+// or nil if there isn't one
+func (c Consensus) Majority() *ConsensusGroup {
+	if len(c.Groups) > 0 && len(c.Groups[0].Responses)*2 > c.total {
+		return &c.Groups[0]
+	}
+
+	return nil
+}
+
+// Outliers returns the responses which aren't part of the majority; if there
+// is no majority, every response is an outlier
+func (c Consensus) Outliers() Responses {
+	var outliers Responses
+	majority := c.Majority()
+	for i, g := range c.Groups {
+		if majority != nil && i == 0 {
+			continue
+		}
+		outliers = append(outliers, g.Responses...)
+	}
+
+	return outliers
+}
+
+// String describes each group, naming the odd servers out
+func (c Consensus) String() string {
+	if len(c.Groups) <= 1 {
+		return fmt.Sprintf("all %d servers agree", c.total)
+	}
+
+	majority := c.Majority()
+	if majority == nil {
+		var groups []string
+		for _, g := range c.Groups {
+			groups = append(groups, "["+strings.Join(g.Servers(), ", ")+"]")
+		}
+		return fmt.Sprintf("no majority among %d servers: %s", c.total, strings.Join(groups, " "))
+	}
+
+	var lines []string
+	for _, g := range c.Groups[1:] {
+		verb := "differs"
+		if len(g.Responses) > 1 {
+			verb = "differ"
+		}
+		line := fmt.Sprintf("%s %s from the other %d",
+			strings.Join(g.Servers(), ", "), verb, len(majority.Responses))
+		if g.Err != nil {
+			line += ":\n  " + strings.Replace(g.Err.Error(), "\n", "\n  ", -1)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Consensus groups the responses by equivalent answer: two responses are
+// equivalent when every assertion passes for the pair of them. With no
+// assertions, they must agree on status and body content.
+func (r Responses) Consensus(assertions ...Assertion) Consensus {
+	if len(assertions) == 0 {
+		assertions = defaultAssertions()
+	}
+
+	equivalent := func(a, b *Response) error {
+		for _, assert := range assertions {
+			if err := assert(Responses{a, b}); err != nil {
+				return withoutReproduction(err)
+			}
+		}
+		return nil
+	}
+
+	c := Consensus{total: len(r)}
+	for _, resp := range r {
+		joined := false
+		for i := range c.Groups {
+			if equivalent(c.Groups[i].Responses[0], resp) == nil {
+				c.Groups[i].Responses = append(c.Groups[i].Responses, resp)
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			c.Groups = append(c.Groups, ConsensusGroup{Responses: Responses{resp}})
+		}
+	}
+
+	// a stable insertion sort, largest first
+	for i := 1; i < len(c.Groups); i++ {
+		for j := i; j > 0 && len(c.Groups[j].Responses) > len(c.Groups[j-1].Responses); j-- {
+			c.Groups[j], c.Groups[j-1] = c.Groups[j-1], c.Groups[j]
+		}
+	}
+
+	if majority := c.Majority(); majority != nil {
+		for i := 1; i < len(c.Groups); i++ {
+			c.Groups[i].Err = equivalent(majority.Responses[0], c.Groups[i].Responses[0])
+		}
+	}
+
+	return c
+}
+
+// ConsensusSame verifies that all responses are equivalent, as Consensus
+// decides; if not, the error names the majority answer and the servers which
+// differ from it, such as "node-3 differs from the other 4".
+func (r Responses) ConsensusSame(assertions ...Assertion) (err error) {
+	defer r.reproducible(&err)
+
+	c := r.Consensus(assertions...)
+	if len(c.Groups) <= 1 {
+		return nil
+	}
+
+	return fmt.Errorf("%s", c)
+}
+
+// responseServer names the server a response came from
+func responseServer(resp *Response) string {
+	if resp.Server != nil {
+		return resp.Server.String()
+	}
+
+	return resp.Request.URL.Host
+}
@@ -0,0 +1,97 @@
+package congruent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func consensusServers(t *testing.T, bodies ...string) Servers {
+	var servers Servers
+	for i, body := range bodies {
+		body := body
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		t.Cleanup(ts.Close)
+		servers = append(servers, &Server{Name: fmt.Sprintf("node-%d", i+1), BaseURI: ts.URL})
+	}
+
+	return servers
+}
+
+func TestConsensus(t *testing.T) {
+	servers := consensusServers(t, `{"v":1}`, `{"v":1}`, `{"v":2}`, `{ "v": 1 }`, `{"v":1}`)
+	responses, err := servers.Request(NewRequest("GET", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := responses.Consensus()
+	if len(c.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(c.Groups))
+	}
+	majority := c.Majority()
+	if majority == nil || strings.Join(majority.Servers(), ",") != "node-1,node-2,node-4,node-5" {
+		t.Errorf("unexpected majority %v", majority)
+	}
+	if outliers := c.Outliers(); len(outliers) != 1 || outliers[0].Server.Name != "node-3" {
+		t.Errorf("unexpected outliers %v", outliers)
+	}
+
+	err = responses.ConsensusSame()
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "node-3 differs from the other 4:\n  ") || !strings.Contains(msg, "$.v: expected 1, was 2") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+	if msg := err.Error(); strings.Count(msg, "reproduce with:") != 1 || !strings.Contains(msg, "\n  # node-3\n  curl "+servers[2].BaseURI+"/ --compressed") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+
+	// byte for byte, node-4 differs too
+	err = responses.ConsensusSame(Responses.BodySame)
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	for _, s := range []string{"node-3 differs from the other 3:", "\nnode-4 differs from the other 3:"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Did not get expected error string %q, got: %v", s, err)
+		}
+	}
+}
+
+func TestConsensusNoMajority(t *testing.T) {
+	servers := consensusServers(t, "a", "b", "a", "b")
+	responses, err := servers.Request(NewRequest("GET", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := responses.Consensus(Responses.BodySame)
+	if c.Majority() != nil {
+		t.Error("expected no majority")
+	}
+	if l := len(c.Outliers()); l != 4 {
+		t.Errorf("expected every response to be an outlier, got %d", l)
+	}
+	expected := "no majority among 4 servers: [node-1, node-3] [node-2, node-4]"
+	if s := c.String(); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+
+	servers = consensusServers(t, "a", "a")
+	responses, err = servers.Request(NewRequest("GET", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.ConsensusSame(Responses.BodySame); err != nil {
+		t.Error(err)
+	}
+	if s := responses.Consensus().String(); s != "all 2 servers agree" {
+		t.Errorf("unexpected consensus %q", s)
+	}
+}
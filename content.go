@@ -0,0 +1,528 @@
+package congruent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ContentOption changes how decoded content is compared by BodyContentSame,
+// and by the other assertions which compare content field by field.
+type ContentOption func(*contentConfig)
+
+type contentConfig struct {
+	ignore      []string
+	ignorePaths []path
+
+	tolerances          []*tolerance
+	distinguishIntegers bool
+	arrays              []*arrayRule
+
+	diffContext  int
+	diffMaxHunks int
+}
+
+// scope is the set of paths an option applies to; with none, it applies
+// everywhere that a more specific option doesn't
+type scope struct {
+	paths  []string
+	parsed []path
+}
+
+func (s *scope) parse() (err error) {
+	s.parsed, err = parsePaths(s.paths)
+	return err
+}
+
+func (s *scope) everywhere() bool {
+	return len(s.paths) == 0
+}
+
+func (s *scope) matches(at []interface{}) bool {
+	for _, p := range s.parsed {
+		if p.matches(at) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scoped picks which of a list of options applies at a location: the last
+// one given for a matching path, or else the last one given for everywhere
+func scoped(n int, scopeOf func(int) *scope, at []interface{}) int {
+	everywhere := -1
+	for i := n - 1; i >= 0; i-- {
+		s := scopeOf(i)
+		if s.everywhere() {
+			if everywhere < 0 {
+				everywhere = i
+			}
+			continue
+		}
+		if s.matches(at) {
+			return i
+		}
+	}
+
+	return everywhere
+}
+
+type toleranceKind int
+
+const (
+	toleranceAbsolute toleranceKind = iota
+	toleranceRelative
+	toleranceTime
+)
+
+// tolerance is how far apart two numbers or timestamps may be and still be
+// equal
+type tolerance struct {
+	scope
+	kind     toleranceKind
+	amount   float64
+	duration time.Duration
+}
+
+// arrayRule is how the elements of arrays are paired up for comparison: by
+// the value of a field, or, with no field, as a multiset
+type arrayRule struct {
+	scope
+	field string
+}
+
+// IgnorePaths skips any value found at one of the given paths when comparing
+// content. Paths are written as `$.meta.requestId`, `$.items[*].updatedAt` or
+// `$['odd key'][0]`.
+func IgnorePaths(paths ...string) ContentOption {
+	return func(c *contentConfig) {
+		c.ignore = append(c.ignore, paths...)
+	}
+}
+
+// AbsoluteTolerance treats numbers as equal when they differ by no more than
+// eps. It applies at the given paths, or everywhere if there are none; a
+// tolerance for a path takes precedence over one that applies everywhere.
+func AbsoluteTolerance(eps float64, paths ...string) ContentOption {
+	return func(c *contentConfig) {
+		c.tolerances = append(c.tolerances, &tolerance{scope: scope{paths: paths}, kind: toleranceAbsolute, amount: eps})
+	}
+}
+
+// RelativeTolerance treats numbers as equal when they differ by no more than
+// the fraction rel of the larger of them, so that 0.01 allows a 1% difference.
+// Paths apply as for AbsoluteTolerance.
+func RelativeTolerance(rel float64, paths ...string) ContentOption {
+	return func(c *contentConfig) {
+		c.tolerances = append(c.tolerances, &tolerance{scope: scope{paths: paths}, kind: toleranceRelative, amount: rel})
+	}
+}
+
+// TimeTolerance treats strings which are both RFC 3339 timestamps as equal
+// when they are no more than d apart. Paths apply as for AbsoluteTolerance.
+func TimeTolerance(d time.Duration, paths ...string) ContentOption {
+	return func(c *contentConfig) {
+		c.tolerances = append(c.tolerances, &tolerance{scope: scope{paths: paths}, kind: toleranceTime, duration: d})
+	}
+}
+
+// DistinguishIntegers treats a number written as an integer as different from
+// the same number written with a fraction or exponent, like `1` and `1.0`,
+// which are otherwise equal. Numbers accepted by a tolerance are equal however
+// they are written.
+func DistinguishIntegers() ContentOption {
+	return func(c *contentConfig) {
+		c.distinguishIntegers = true
+	}
+}
+
+// UnorderedArrays compares arrays as multisets, so that they are equal when
+// every element of one has a matching element in the other, in any order. It
+// applies to arrays at the given paths, or to all arrays if there are none.
+func UnorderedArrays(paths ...string) ContentOption {
+	return func(c *contentConfig) {
+		c.arrays = append(c.arrays, &arrayRule{scope: scope{paths: paths}})
+	}
+}
+
+// MatchArraysBy compares arrays of objects by pairing up the elements which
+// have the same value for a field, like `id`, in any order. Differences are
+// reported by that value, as in `$.items[id=42].price`, rather than by a
+// position which may have shifted. Paths apply as for UnorderedArrays.
+func MatchArraysBy(field string, paths ...string) ContentOption {
+	return func(c *contentConfig) {
+		c.arrays = append(c.arrays, &arrayRule{scope: scope{paths: paths}, field: field})
+	}
+}
+
+func newContentConfig(opts []ContentOption) (*contentConfig, error) {
+	c := &contentConfig{diffContext: DefaultDiffContext, diffMaxHunks: DefaultDiffMaxHunks}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	paths, err := parsePaths(c.ignore)
+	if err != nil {
+		return nil, err
+	}
+	c.ignorePaths = paths
+
+	for _, t := range c.tolerances {
+		if err := t.parse(); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range c.arrays {
+		if err := a.parse(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// tolerance finds the tolerance of a kind in effect at a location
+func (c *contentConfig) tolerance(kind toleranceKind, at []interface{}) *tolerance {
+	var of []*tolerance
+	for _, t := range c.tolerances {
+		if t.kind == kind {
+			of = append(of, t)
+		}
+	}
+
+	if i := scoped(len(of), func(i int) *scope { return &of[i].scope }, at); i >= 0 {
+		return of[i]
+	}
+
+	return nil
+}
+
+// arrayRule finds how arrays are compared at a location, or nil if they are
+// compared in order
+func (c *contentConfig) arrayRule(at []interface{}) *arrayRule {
+	if i := scoped(len(c.arrays), func(i int) *scope { return &c.arrays[i].scope }, at); i >= 0 {
+		return c.arrays[i]
+	}
+
+	return nil
+}
+
+func (c *contentConfig) ignored(at []interface{}) bool {
+	for _, p := range c.ignorePaths {
+		if p.matches(at) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentMismatch describes the first difference found between two values
+type contentMismatch struct {
+	at       []interface{}
+	reason   string
+	expected interface{}
+	received interface{}
+}
+
+func (m *contentMismatch) String() string {
+	if m.reason != "" {
+		return fmt.Sprintf("%s: %s", formatLocation(m.at), m.reason)
+	}
+
+	return fmt.Sprintf("%s: expected %s, was %s",
+		formatLocation(m.at), formatValue(m.expected), formatValue(m.received))
+}
+
+// formatValue renders a decoded value as compact JSON for error messages
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(cutBody(b))
+}
+
+// compareContent walks two decoded values, such as those produced by
+// json.Unmarshal, and returns the first difference between them
+func compareContent(c *contentConfig, at []interface{}, a, b interface{}) *contentMismatch {
+	if c.ignored(at) {
+		return nil
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			return &contentMismatch{at: at, expected: a, received: b}
+		}
+
+		for _, k := range sortedKeys(av) {
+			loc := appendLocation(at, k)
+			bval, ok := bv[k]
+			if !ok {
+				if c.ignored(loc) {
+					continue
+				}
+				return &contentMismatch{at: loc, reason: "missing"}
+			}
+			if m := compareContent(c, loc, av[k], bval); m != nil {
+				return m
+			}
+		}
+		for _, k := range sortedKeys(bv) {
+			loc := appendLocation(at, k)
+			if _, ok := av[k]; !ok && !c.ignored(loc) {
+				return &contentMismatch{at: loc, reason: "unexpected"}
+			}
+		}
+
+		return nil
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			return &contentMismatch{at: at, expected: a, received: b}
+		}
+
+		if rule := c.arrayRule(at); rule != nil && rule.field != "" {
+			return compareKeyed(c, at, rule.field, av, bv)
+		}
+
+		if la, lb := len(av), len(bv); la != lb {
+			return &contentMismatch{
+				at:     at,
+				reason: fmt.Sprintf("expected length %d, was %d", la, lb),
+			}
+		}
+		if rule := c.arrayRule(at); rule != nil {
+			return compareUnordered(c, at, av, bv)
+		}
+		for i := range av {
+			if m := compareContent(c, appendLocation(at, i), av[i], bv[i]); m != nil {
+				return m
+			}
+		}
+
+		return nil
+	case float64, json.Number:
+		if !c.numbersEqual(at, a, b) {
+			return &contentMismatch{at: at, expected: a, received: b}
+		}
+
+		return nil
+	case string:
+		if a != b && !c.timesEqual(at, av, b) {
+			return &contentMismatch{at: at, expected: a, received: b}
+		}
+
+		return nil
+	default:
+		if !reflect.DeepEqual(a, b) {
+			return &contentMismatch{at: at, expected: a, received: b}
+		}
+
+		return nil
+	}
+}
+
+// compareUnordered pairs each element of a with the first unpaired element of b
+// that it equals
+func compareUnordered(c *contentConfig, at []interface{}, a, b []interface{}) *contentMismatch {
+	paired := make([]bool, len(b))
+
+	for i := range a {
+		loc := appendLocation(at, i)
+		found := false
+		for j := range b {
+			if !paired[j] && compareContent(c, loc, a[i], b[j]) == nil {
+				paired[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			return &contentMismatch{at: loc, reason: fmt.Sprintf("no element matches %s", formatValue(a[i]))}
+		}
+	}
+
+	return nil
+}
+
+// compareKeyed pairs up the elements of a and b which have the same value for
+// a field, and compares each pair
+func compareKeyed(c *contentConfig, at []interface{}, field string, a, b []interface{}) *contentMismatch {
+	key := func(v interface{}, i int) (keyedElement, *contentMismatch) {
+		obj, ok := v.(map[string]interface{})
+		if ok {
+			if k, ok := obj[field]; ok {
+				return keyedElement{index: i, field: field, value: k}, nil
+			}
+		}
+
+		return keyedElement{}, &contentMismatch{
+			at:     appendLocation(at, i),
+			reason: fmt.Sprintf("element has no %s to match by", field),
+		}
+	}
+
+	var bkeys []keyedElement
+	for j := range b {
+		k, m := key(b[j], j)
+		if m != nil {
+			return m
+		}
+		bkeys = append(bkeys, k)
+	}
+
+	paired := make([]bool, len(b))
+	for i := range a {
+		ak, m := key(a[i], i)
+		if m != nil {
+			return m
+		}
+		loc := appendLocation(at, ak)
+
+		found := false
+		for j := range b {
+			if !paired[j] && reflect.DeepEqual(ak.value, bkeys[j].value) {
+				paired[j], found = true, true
+				if m := compareContent(c, loc, a[i], b[j]); m != nil {
+					return m
+				}
+				break
+			}
+		}
+		if !found {
+			return &contentMismatch{at: loc, reason: "missing"}
+		}
+	}
+
+	for j := range b {
+		if !paired[j] {
+			return &contentMismatch{at: appendLocation(at, bkeys[j]), reason: "unexpected"}
+		}
+	}
+
+	return nil
+}
+
+func (c *contentConfig) numbersEqual(at []interface{}, a, b interface{}) bool {
+	// compared exactly first, by decimal value, so that numbers too large or
+	// too precise for a float64, like 64-bit IDs, are still told apart, and
+	// `1.50` equals `1.5`
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		if an == bn {
+			return true
+		}
+		ar, ok := new(big.Rat).SetString(string(an))
+		br, ok2 := new(big.Rat).SetString(string(bn))
+		sameForm := !c.distinguishIntegers || isIntegerLiteral(an) == isIntegerLiteral(bn)
+		if ok && ok2 && ar.Cmp(br) == 0 && sameForm {
+			return true
+		}
+	}
+
+	// tolerances need both as float64s
+	af, ok := toFloat(a)
+	if !ok {
+		return false
+	}
+	bf, ok := toFloat(b)
+	if !ok {
+		return false
+	}
+
+	diff := math.Abs(af - bf)
+	if t := c.tolerance(toleranceAbsolute, at); t != nil && diff <= t.amount {
+		return true
+	}
+	if t := c.tolerance(toleranceRelative, at); t != nil && diff <= t.amount*math.Max(math.Abs(af), math.Abs(bf)) {
+		return true
+	}
+
+	return !(aok && bok) && af == bf
+}
+
+// isIntegerLiteral reports whether a number was written without a fraction or
+// exponent
+func isIntegerLiteral(n json.Number) bool {
+	return !strings.ContainsAny(string(n), ".eE")
+}
+
+// timesEqual reports whether two strings are RFC 3339 timestamps within the
+// time tolerance in effect
+func (c *contentConfig) timesEqual(at []interface{}, a string, b interface{}) bool {
+	bs, ok := b.(string)
+	if !ok {
+		return false
+	}
+	t := c.tolerance(toleranceTime, at)
+	if t == nil {
+		return false
+	}
+
+	ta, err := time.Parse(time.RFC3339Nano, a)
+	if err != nil {
+		return false
+	}
+	tb, err := time.Parse(time.RFC3339Nano, bs)
+	if err != nil {
+		return false
+	}
+
+	diff := ta.Sub(tb)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= t.duration
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// decodeContent unmarshals a body as JSON, reporting whether it was JSON at all.
+// Numbers are kept as they were written, as json.Number.
+func decodeContent(b []byte) (interface{}, bool) {
+	var content interface{}
+	if err := unmarshalNumbers(b, &content); err != nil {
+		return nil, false
+	}
+
+	return content, true
+}
+
+// unmarshalNumbers is json.Unmarshal, keeping numbers as json.Number
+func unmarshalNumbers(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+
+	// like json.Unmarshal, anything after the value is an error
+	if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package congruent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareContent(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		ignore []string
+		expect string
+	}{
+		{`{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1.0}`, nil, ""},
+		{`{"a":1}`, `{"a":2}`, nil, "$.a: expected 1, was 2"},
+		{`{"a":1}`, `{}`, nil, "$.a: missing"},
+		{`{}`, `{"a":1}`, nil, "$.a: unexpected"},
+		{`[1,2]`, `[1]`, nil, "$: expected length 2, was 1"},
+		{`{"a":{"b":"c"}}`, `{"a":"c"}`, nil, `$.a: expected {"b":"c"}, was "c"`},
+		{`{"a":1,"id":"x"}`, `{"a":1,"id":"y"}`, []string{"$.id"}, ""},
+		{`{"a":1}`, `{"a":1,"id":"y"}`, []string{"$.id"}, ""},
+		{`{"i":[{"t":1,"v":1},{"t":2,"v":1}]}`, `{"i":[{"t":3,"v":1},{"t":4,"v":1}]}`, []string{"$.i[*].t"}, ""},
+		{`{"i":[{"t":1,"v":1}]}`, `{"i":[{"t":3,"v":2}]}`, []string{"$.i[*].t"}, "$.i[0].v: expected 1, was 2"},
+	}
+
+	for _, c := range cases {
+		cfg, err := newContentConfig([]ContentOption{IgnorePaths(c.ignore...)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, _ := decodeContent([]byte(c.a))
+		b, _ := decodeContent([]byte(c.b))
+
+		m := compareContent(cfg, nil, a, b)
+		switch {
+		case m == nil && c.expect != "":
+			t.Errorf("%s vs %s: expected mismatch %q, got none", c.a, c.b, c.expect)
+		case m != nil && m.String() != c.expect:
+			t.Errorf("%s vs %s: expected %q, got %q", c.a, c.b, c.expect, m)
+		}
+	}
+}
+
+func TestCompareContentTolerance(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		opts   []ContentOption
+		expect string
+	}{
+		{`{"a":1}`, `{"a":1.0}`, []ContentOption{DistinguishIntegers()}, "$.a: expected 1, was 1.0"},
+		{`{"a":1}`, `{"a":1e0}`, []ContentOption{DistinguishIntegers()}, "$.a: expected 1, was 1e0"},
+		{`{"a":1.0}`, `{"a":1e0}`, []ContentOption{DistinguishIntegers()}, ""},
+		// tolerances apply however the numbers are written
+		{`{"p":20}`, `{"p":19.99}`, []ContentOption{AbsoluteTolerance(0.05)}, ""},
+		{`{"p":20}`, `{"p":19.99}`, []ContentOption{AbsoluteTolerance(0.05), DistinguishIntegers()}, ""},
+		{`{"p":20}`, `{"p":19.9}`, []ContentOption{AbsoluteTolerance(0.05)}, "$.p: expected 20, was 19.9"},
+		{`{"p":19.99}`, `{"p":19.990000001}`, nil, "$.p: expected 19.99, was 19.990000001"},
+		{`{"p":19.99}`, `{"p":19.990000001}`, []ContentOption{AbsoluteTolerance(1e-6)}, ""},
+		{`{"p":19.99}`, `{"p":19.98}`, []ContentOption{AbsoluteTolerance(1e-6)}, "$.p: expected 19.99, was 19.98"},
+		{`{"p":100.0,"q":100.0}`, `{"p":101.0,"q":101.0}`, []ContentOption{RelativeTolerance(0.02, "$.p")}, "$.q: expected 100.0, was 101.0"},
+		{`{"p":100.0,"q":100.0}`, `{"p":101.0,"q":101.0}`, []ContentOption{RelativeTolerance(0.02)}, ""},
+		// a tolerance for a path wins over one for everywhere
+		{`{"p":1.0,"q":1.0}`, `{"p":1.5,"q":1.5}`, []ContentOption{AbsoluteTolerance(1, "$.p"), AbsoluteTolerance(0.1)}, "$.q: expected 1.0, was 1.5"},
+		{`{"p":1.0,"q":1.0}`, `{"p":1.5,"q":1.05}`, []ContentOption{AbsoluteTolerance(0.1), AbsoluteTolerance(0, "$.q"), AbsoluteTolerance(1, "$.p")}, "$.q: expected 1.0, was 1.05"},
+		{`{"t":"2020-01-01T00:00:00Z"}`, `{"t":"2020-01-01T00:00:00.004Z"}`, nil, `$.t: expected "2020-01-01T00:00:00Z", was "2020-01-01T00:00:00.004Z"`},
+		{`{"t":"2020-01-01T00:00:00Z"}`, `{"t":"2020-01-01T01:00:00.004+01:00"}`, []ContentOption{TimeTolerance(5 * time.Millisecond)}, ""},
+		{`{"t":"2020-01-01T00:00:00Z"}`, `{"t":"2020-01-01T00:00:00.006Z"}`, []ContentOption{TimeTolerance(5 * time.Millisecond)}, `$.t: expected "2020-01-01T00:00:00Z", was "2020-01-01T00:00:00.006Z"`},
+		{`{"t":"yesterday"}`, `{"t":"today"}`, []ContentOption{TimeTolerance(time.Hour)}, `$.t: expected "yesterday", was "today"`},
+	}
+
+	for _, c := range cases {
+		cfg, err := newContentConfig(c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, _ := decodeContent([]byte(c.a))
+		b, _ := decodeContent([]byte(c.b))
+
+		m := compareContent(cfg, nil, a, b)
+		switch {
+		case m == nil && c.expect != "":
+			t.Errorf("%s vs %s: expected mismatch %q, got none", c.a, c.b, c.expect)
+		case m != nil && m.String() != c.expect:
+			t.Errorf("%s vs %s: expected %q, got %q", c.a, c.b, c.expect, m)
+		}
+	}
+
+	if _, err := newContentConfig([]ContentOption{AbsoluteTolerance(1, "p")}); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestCompareContentArrays(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		opts   []ContentOption
+		expect string
+	}{
+		{`[1,2,2,3]`, `[2,3,1,2]`, nil, "$[0]: expected 1, was 2"},
+		{`[1,2,2,3]`, `[2,3,1,2]`, []ContentOption{UnorderedArrays()}, ""},
+		{`[1,2,2,3]`, `[2,3,1,3]`, []ContentOption{UnorderedArrays()}, "$[2]: no element matches 2"},
+		{`[1,2]`, `[2]`, []ContentOption{UnorderedArrays()}, "$: expected length 2, was 1"},
+		{`{"a":[1,2],"b":[1,2]}`, `{"a":[2,1],"b":[2,1]}`, []ContentOption{UnorderedArrays("$.a")}, "$.b[0]: expected 1, was 2"},
+		{`[{"t":[1,2]},{"t":[3]}]`, `[{"t":[3]},{"t":[2,1]}]`, []ContentOption{UnorderedArrays()}, ""},
+		{
+			`{"items":[{"id":41,"price":1},{"id":42,"price":10}]}`,
+			`{"items":[{"id":42,"price":12},{"id":41,"price":1}]}`,
+			[]ContentOption{MatchArraysBy("id", "$.items")},
+			"$.items[id=42].price: expected 10, was 12",
+		},
+		{
+			`{"items":[{"id":"a","v":1},{"id":"b","v":2}]}`,
+			`{"items":[{"id":"b","v":2},{"id":"a","v":1}]}`,
+			[]ContentOption{MatchArraysBy("id")},
+			"",
+		},
+		{`[{"id":1},{"id":2}]`, `[{"id":2}]`, []ContentOption{MatchArraysBy("id")}, "$[id=1]: missing"},
+		{`[{"id":1}]`, `[{"id":1},{"id":3}]`, []ContentOption{MatchArraysBy("id")}, "$[id=3]: unexpected"},
+		{`[{"id":1}]`, `[{"name":1}]`, []ContentOption{MatchArraysBy("id")}, "$[0]: element has no id to match by"},
+		// index paths still select elements which were matched by key
+		{
+			`[{"id":1,"at":"x"},{"id":2,"at":"y"}]`,
+			`[{"id":2,"at":"z"},{"id":1,"at":"x"}]`,
+			[]ContentOption{MatchArraysBy("id"), IgnorePaths("$[1].at")},
+			"",
+		},
+	}
+
+	for _, c := range cases {
+		cfg, err := newContentConfig(c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, _ := decodeContent([]byte(c.a))
+		b, _ := decodeContent([]byte(c.b))
+
+		m := compareContent(cfg, nil, a, b)
+		switch {
+		case m == nil && c.expect != "":
+			t.Errorf("%s vs %s: expected mismatch %q, got none", c.a, c.b, c.expect)
+		case m != nil && m.String() != c.expect:
+			t.Errorf("%s vs %s: expected %q, got %q", c.a, c.b, c.expect, m)
+		}
+	}
+}
+
+func TestCompareContentNumbers(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		expect string
+	}{
+		{`{"id":9007199254740993}`, `{"id":9007199254740992}`, "$.id: expected 9007199254740993, was 9007199254740992"},
+		{`{"id":18446744073709551615}`, `{"id":18446744073709551615}`, ""},
+		{`{"price":1.50}`, `{"price":1.5}`, ""},
+		{`{"price":1.5e1}`, `{"price":15.0}`, ""},
+		{`{"price":15}`, `{"price":1.5e1}`, ""},
+		{`{"n":1}`, `{"n":1.0}`, ""},
+		{`{"id":9007199254740993}`, `{"id":9007199254740993.0}`, ""},
+		{`{"price":0.30000000000000001}`, `{"price":0.3}`, "$.price: expected 0.30000000000000001, was 0.3"},
+		{`{"n":-0}`, `{"n":0}`, ""},
+		{`{"n":1e400}`, `{"n":1e400}`, ""},
+		{`{"n":1e400}`, `{"n":10e399}`, ""},
+		{`{"n":1e400}`, `{"n":2e400}`, "$.n: expected 1e400, was 2e400"},
+	}
+
+	for _, c := range cases {
+		a, _ := decodeContent([]byte(c.a))
+		b, _ := decodeContent([]byte(c.b))
+
+		m := compareContent(&contentConfig{}, nil, a, b)
+		switch {
+		case m == nil && c.expect != "":
+			t.Errorf("%s vs %s: expected mismatch %q, got none", c.a, c.b, c.expect)
+		case m != nil && m.String() != c.expect:
+			t.Errorf("%s vs %s: expected %q, got %q", c.a, c.b, c.expect, m)
+		}
+	}
+
+	// a tolerance still applies to numbers which differ exactly
+	cfg, err := newContentConfig([]ContentOption{AbsoluteTolerance(0.1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := decodeContent([]byte(`1.25`))
+	b, _ := decodeContent([]byte(`1.3`))
+	if m := compareContent(cfg, nil, a, b); m != nil {
+		t.Errorf("expected no mismatch, got %q", m)
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	if v, ok := decodeContent([]byte(`{"n":12345678901234567890}`)); !ok {
+		t.Error("expected JSON")
+	} else if n := v.(map[string]interface{})["n"]; n != json.Number("12345678901234567890") {
+		t.Errorf("expected the number to be kept as written, got %v", n)
+	}
+}
+
+func TestBodyContentSameIgnorePaths(t *testing.T) {
+	u, err := url.Parse("http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockReq := &http.Request{Method: "GET", URL: u}
+
+	responses := Responses{
+		&Response{Request: mockReq, Body: []byte(`{"ok":true,"requestId":"a"}`), StatusCode: 200},
+		&Response{Request: mockReq, Body: []byte(`{"ok":true,"requestId":"b"}`), StatusCode: 200}}
+
+	if err := responses.BodyContentSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "$.requestId") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	if err := responses.BodyContentSame(IgnorePaths("$.requestId")); err != nil {
+		t.Error(err)
+	}
+
+	if err := responses.BodyContentSame(IgnorePaths("requestId")); err == nil {
+		t.Error("Expected error for an invalid path, but got none!")
+	}
+}
+
+func TestUnmarshalNumbers(t *testing.T) {
+	var v interface{}
+	if err := unmarshalNumbers([]byte(` {"n":12345678901234567890} `), &v); err != nil {
+		t.Fatal(err)
+	}
+	if n := v.(map[string]interface{})["n"]; n != json.Number("12345678901234567890") {
+		t.Errorf("expected the number to be kept as written, got %v", n)
+	}
+
+	for _, b := range []string{`{"a":1} trailing`, `{"a":1}{"b":2}`, `1 2`} {
+		if err := unmarshalNumbers([]byte(b), &v); err == nil {
+			t.Errorf("Expected error for %s, but got none!", b)
+		}
+	}
+}
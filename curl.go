@@ -0,0 +1,459 @@
+package congruent
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// curlSwitches are curl options which take no value and don't change the
+// request, so are accepted and ignored
+var curlSwitches = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-v": true, "--verbose": true, "-i": true, "--include": true,
+	"-L": true, "--location": true, "-k": true, "--insecure": true,
+	"-f": true, "--fail": true, "--compressed": true,
+}
+
+// ParseCurl parses a curl command line into a Request. It understands `-X`,
+// `-H`, `-d` and its variants, `--data-urlencode`, `-G`, `-u` and `-F`, along
+// with options which don't change the request, like `-s`; any other option is
+// an error. Values may be quoted as in a POSIX shell, and a value starting with
+// `@` is read from a file as curl would. Only the path and query of the URL are
+// kept, so that the Request can be made against any Server.
+func ParseCurl(cmd string) (*Request, error) {
+	args, err := shellWords(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	var (
+		method, rawURL string
+		data           []string
+		get            bool
+		headers        = http.Header{}
+		form           = &bytes.Buffer{}
+		mw             *multipart.Writer
+	)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if rawURL != "" {
+				return nil, fmt.Errorf("curl: more than one URL: %s, %s", rawURL, arg)
+			}
+			rawURL = arg
+			continue
+		}
+
+		if curlSwitches[arg] || isCurlSwitches(arg) {
+			continue
+		}
+		if arg == "-G" || arg == "--get" {
+			get = true
+			continue
+		}
+
+		// short options may have their value attached, like `-XPOST`
+		name, value, hasValue := arg, "", false
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("curl: %s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "-X", "--request":
+			method = value
+		case "--url":
+			rawURL = value
+		case "-H", "--header":
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("curl: malformed header %q", value)
+			}
+			headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		case "-A", "--user-agent":
+			headers.Set("User-Agent", value)
+		case "-u", "--user":
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("curl: -u needs a password, as user:password")
+			}
+			headers.Set("Authorization", BasicAuth(parts[0], parts[1]))
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw":
+			if strings.HasPrefix(value, "@") && name != "--data-raw" {
+				b, err := ioutil.ReadFile(value[1:])
+				if err != nil {
+					return nil, fmt.Errorf("curl: %v", err)
+				}
+				value = string(b)
+				if name != "--data-binary" {
+					value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+				}
+			}
+			data = append(data, value)
+		case "--data-urlencode":
+			encoded, err := curlURLEncode(value)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, encoded)
+		case "-F", "--form":
+			if mw == nil {
+				mw = multipart.NewWriter(form)
+			}
+			if err := curlFormField(mw, value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("curl: unsupported option %s", name)
+		}
+	}
+
+	if rawURL == "" {
+		return nil, fmt.Errorf("curl: no URL given")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("curl: %v", err)
+	}
+	if mw != nil && len(data) > 0 {
+		return nil, fmt.Errorf("curl: -F can't be used with -d")
+	}
+
+	var body interface{}
+	switch {
+	case len(data) > 0 && get:
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += strings.Join(data, "&")
+	case len(data) > 0:
+		body = strings.Join(data, "&")
+		if headers.Get("Content-Type") == "" {
+			headers.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	case mw != nil:
+		if err := mw.Close(); err != nil {
+			return nil, err
+		}
+		body = form.String()
+		if headers.Get("Content-Type") == "" {
+			headers.Set("Content-Type", mw.FormDataContentType())
+		}
+	}
+
+	if method == "" {
+		method = "GET"
+		if body != nil {
+			method = "POST"
+		}
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+
+	var h *http.Header
+	if len(headers) > 0 {
+		h = &headers
+	}
+
+	return NewRequest(method, p, h, body), nil
+}
+
+// isCurlSwitches reports whether arg is a group of short switches, like `-sS`
+func isCurlSwitches(arg string) bool {
+	if strings.HasPrefix(arg, "--") || len(arg) < 3 {
+		return false
+	}
+	for _, c := range arg[1:] {
+		if !curlSwitches["-"+string(c)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// curlURLEncode encodes a `--data-urlencode` value, which is one of `content`,
+// `=content`, `name=content`, `@file` or `name@file`
+func curlURLEncode(value string) (string, error) {
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	read := func(p string) (string, error) {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", fmt.Errorf("curl: %v", err)
+		}
+		return string(b), nil
+	}
+
+	if i := strings.IndexAny(value, "=@"); i >= 0 {
+		name, content := value[:i], value[i+1:]
+		if value[i] == '@' {
+			var err error
+			if content, err = read(content); err != nil {
+				return "", err
+			}
+		}
+		if name == "" {
+			return escape(content), nil
+		}
+		return name + "=" + escape(content), nil
+	}
+
+	return escape(value), nil
+}
+
+// curlFormField adds a `-F` field to a multipart form; `name=@file` uploads a
+// file, `name=<file` sends a file's content as the value, and `;type=` sets the
+// content type of a part
+func curlFormField(mw *multipart.Writer, field string) error {
+	parts := strings.SplitN(field, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("curl: malformed form field %q", field)
+	}
+	name, value := parts[0], parts[1]
+
+	contentType := ""
+	if i := strings.Index(value, ";type="); i >= 0 {
+		value, contentType = value[:i], value[i+len(";type="):]
+	}
+
+	h := textproto.MIMEHeader{}
+	var content []byte
+	switch {
+	case strings.HasPrefix(value, "@"):
+		b, err := ioutil.ReadFile(value[1:])
+		if err != nil {
+			return fmt.Errorf("curl: %v", err)
+		}
+		content = b
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, name, filepath.Base(value[1:])))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	case strings.HasPrefix(value, "<"):
+		b, err := ioutil.ReadFile(value[1:])
+		if err != nil {
+			return fmt.Errorf("curl: %v", err)
+		}
+		content = b
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q`, name))
+	default:
+		content = []byte(value)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q`, name))
+	}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+
+	return err
+}
+
+// shellWords splits a command line into words as a POSIX shell would, handling
+// quotes, backslash escapes and line continuations; nothing is expanded
+func shellWords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+			if c == '\n' {
+				continue
+			}
+			if quote == '"' && !strings.ContainsRune("$`\"\\", c) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(c)
+			inWord = true
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\\':
+			escaped = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("curl: unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// shellQuote quotes a word for a POSIX shell, leaving it alone if it is safe
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%") == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Curl renders the Request as a curl command line, as it would be sent to the
+// Server: against its BaseURI, with its headers merged in and its middleware
+// applied
+func (r Request) Curl(s *Server) (string, error) {
+	req, err := r.newHTTPRequest(s)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := requestBody(req)
+	if err != nil {
+		return "", err
+	}
+
+	return curlCommand(req, body), nil
+}
+
+// curlCommand renders an http.Request as a curl command line. The
+// `Accept-Encoding` that Do sends by default is left to curl's `--compressed`,
+// so that the response is readable.
+func curlCommand(req *http.Request, body []byte) string {
+	args := []string{"curl"}
+	if req.Method != "GET" || len(body) > 0 {
+		args = append(args, "-X", shellQuote(req.Method))
+	}
+	args = append(args, shellQuote(req.URL.String()))
+
+	compressed := false
+	for _, k := range sortedHeaderKeys(req.Header) {
+		for _, v := range req.Header[k] {
+			if k == "Accept-Encoding" && v == acceptEncoding() {
+				compressed = true
+				continue
+			}
+			args = append(args, "-H", shellQuote(k+": "+v))
+		}
+	}
+	if len(body) > 0 {
+		args = append(args, "--data-raw", shellQuote(string(body)))
+	}
+	if compressed {
+		args = append(args, "--compressed")
+	}
+
+	return strings.Join(args, " ")
+}
+
+// MismatchError is an assertion's failure, reported with curl commands which
+// make the request against each server, so that it can be reproduced by hand
+type MismatchError struct {
+	Err       error
+	Responses Responses
+}
+
+func (e *MismatchError) Error() string {
+	return e.Err.Error() + "\n" + reproduce(e.Responses)
+}
+
+// Unwrap returns the failure without the curl commands
+func (e *MismatchError) Unwrap() error {
+	return e.Err
+}
+
+// reproducible is deferred by assertions, to report their failures as a
+// MismatchError
+func (r Responses) reproducible(err *error) {
+	if *err == nil {
+		return
+	}
+	if _, ok := (*err).(*MismatchError); ok {
+		return
+	}
+
+	*err = &MismatchError{Err: *err, Responses: r}
+}
+
+// withoutReproduction strips the curl commands from a MismatchError, for
+// reports which list them once for several failures
+func withoutReproduction(err error) error {
+	if m, ok := err.(*MismatchError); ok {
+		return m.Err
+	}
+
+	return err
+}
+
+// reproduce lists curl commands for the request each response answered
+func reproduce(r Responses) string {
+	var b strings.Builder
+	b.WriteString("reproduce with:")
+	for _, resp := range r {
+		if resp == nil || resp.Request == nil || resp.Request.URL == nil {
+			continue
+		}
+
+		body, err := requestBody(resp.Request)
+		if err != nil {
+			fmt.Fprintf(&b, "\n  # %s\n  %v", responseServer(resp), err)
+			continue
+		}
+		fmt.Fprintf(&b, "\n  # %s\n  %s", responseServer(resp), curlCommand(resp.Request, body))
+	}
+
+	return b.String()
+}
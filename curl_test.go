@@ -0,0 +1,238 @@
+package congruent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseCurl(t *testing.T) {
+	cmd := `curl -sS -X PUT 'https://api.example.com/v1/words?lang=en' \
+  -H "Content-Type: application/json" -H 'X-Quote: it'\''s' \
+  -u alice:s3cret \
+  -d '{"word": "hello"}'`
+
+	r, err := ParseCurl(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != "PUT" || r.Path != "/v1/words?lang=en" {
+		t.Errorf("unexpected request line %s %s", r.Method, r.Path)
+	}
+	if r.Body != `{"word": "hello"}` {
+		t.Errorf("unexpected body %v", r.Body)
+	}
+	for k, v := range map[string]string{
+		"Content-Type":  "application/json",
+		"X-Quote":       "it's",
+		"Authorization": BasicAuth("alice", "s3cret"),
+	} {
+		if h := r.Headers.Get(k); h != v {
+			t.Errorf("expected %s to be %q, got %q", k, v, h)
+		}
+	}
+
+	// data implies POST and a form body; several are joined with `&`
+	r, err = ParseCurl(`curl localhost:8080 -d a=1 --data-urlencode 'q=hello world&more' -HX-Test:1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != "POST" || r.Path != "/" || r.Body != "a=1&q=hello%20world%26more" {
+		t.Errorf("unexpected request %#v", r)
+	}
+	if r.Headers.Get("Content-Type") != "application/x-www-form-urlencoded" || r.Headers.Get("X-Test") != "1" {
+		t.Errorf("unexpected headers %v", r.Headers)
+	}
+
+	r, err = ParseCurl(`curl -G http://x/search?a=1 --data-urlencode "q=a b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != "GET" || r.Path != "/search?a=1&q=a%20b" || r.Body != nil {
+		t.Errorf("unexpected request %#v", r)
+	}
+
+	for _, cmd := range []string{
+		`curl -X POST`,
+		`curl http://x -Z`,
+		`curl http://x -H 'unterminated`,
+		`curl http://x -H NoColon`,
+		`curl http://x -u alice`,
+		`curl http://x -X`,
+		`curl http://x -d a -F b=c`,
+	} {
+		if _, err := ParseCurl(cmd); err == nil {
+			t.Errorf("Expected error for %s, but got none!", cmd)
+		}
+	}
+}
+
+func TestParseCurlForm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "congruent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	upload := filepath.Join(dir, "words.txt")
+	ioutil.WriteFile(upload, []byte("hello\nworld\n"), 0644)
+
+	r, err := ParseCurl(`curl http://x/upload -F name=words -F "file=@` + upload + `;type=text/plain"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != "POST" {
+		t.Errorf("expected POST, got %s", r.Method)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("unexpected content type %q: %v", r.Headers.Get("Content-Type"), err)
+	}
+	form, err := multipart.NewReader(strings.NewReader(r.Body.(string)), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := form.Value["name"]; len(v) != 1 || v[0] != "words" {
+		t.Errorf("unexpected form values %v", form.Value)
+	}
+	files := form.File["file"]
+	if len(files) != 1 || files[0].Filename != "words.txt" || files[0].Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected form files %v", form.File)
+	}
+	f, _ := files[0].Open()
+	defer f.Close()
+	if b, _ := ioutil.ReadAll(f); string(b) != "hello\nworld\n" {
+		t.Errorf("unexpected file content %q", b)
+	}
+}
+
+func TestCurl(t *testing.T) {
+	server := NewServer("http://old.example.com/api", &http.Header{"Authorization": {"Bearer abc"}})
+	r := NewRequest("POST", "/words", &http.Header{"X-Test": {"it's"}}, map[string]string{"word": "hello"})
+
+	cmd, err := r.Curl(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `curl -X POST http://old.example.com/api/words -H 'Authorization: Bearer abc' -H 'X-Test: it'\''s' --data-raw '{"word":"hello"}'`
+	if cmd != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, cmd)
+	}
+
+	// the command parses back into the same request
+	parsed, err := ParseCurl(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method != "POST" || parsed.Path != "/api/words" || parsed.Body != `{"word":"hello"}` || parsed.Headers.Get("X-Test") != "it's" {
+		t.Errorf("unexpected request %#v", parsed)
+	}
+
+	if cmd, _ := NewRequest("GET", "/", nil, nil).Curl(server); cmd != "curl http://old.example.com/api/ -H 'Authorization: Bearer abc'" {
+		t.Errorf("unexpected command %s", cmd)
+	}
+}
+
+func TestMismatchReproduction(t *testing.T) {
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "one")
+	}))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		fmt.Fprint(w, "two")
+	}))
+	defer ts1.Close()
+
+	servers := Servers{
+		&Server{Name: "old", BaseURI: ts0.URL, Headers: &http.Header{"X-Token": {"a"}}},
+		&Server{Name: "new", BaseURI: ts1.URL, Headers: &http.Header{"X-Token": {"b"}}},
+	}
+	responses, err := servers.Request(NewRequest("POST", "/words", nil, "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range []error{responses.StatusEqual(200), responses.BodySame(), responses.BodyContentSame()} {
+		if err == nil {
+			t.Fatal("Expected error, but got none!")
+		}
+		var m *MismatchError
+		if !errors.As(err, &m) {
+			t.Fatalf("expected a MismatchError, got %T", err)
+		}
+		msg := err.Error()
+		if !strings.HasPrefix(msg, m.Err.Error()+"\nreproduce with:\n") {
+			t.Errorf("Did not get expected error string, got: %v", msg)
+		}
+		for _, s := range []string{
+			"\n  # old\n  curl -X POST " + ts0.URL + "/words -H 'X-Token: a' --data-raw hello --compressed",
+			"\n  # new\n  curl -X POST " + ts1.URL + "/words -H 'X-Token: b' --data-raw hello --compressed",
+		} {
+			if !strings.Contains(msg, s) {
+				t.Errorf("Did not get expected error string %q, got: %v", s, msg)
+			}
+		}
+	}
+}
+
+func TestMismatchReproductionBodies(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(b))
+		status := 200 + len(received)%2
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	servers := Servers{&Server{Name: "old", BaseURI: ts.URL}, &Server{Name: "new", BaseURI: ts.URL}}
+
+	cases := []struct {
+		body     interface{}
+		received string
+		curl     string
+	}{
+		{nil, "", "curl -X POST " + ts.URL + "/words --compressed"},
+		{"", "", "curl -X POST " + ts.URL + "/words --compressed"},
+		{"null", "null", "curl -X POST " + ts.URL + "/words --data-raw null --compressed"},
+		{json.RawMessage("null"), "null", "curl -X POST " + ts.URL + "/words --data-raw null --compressed"},
+	}
+
+	for _, c := range cases {
+		received = nil
+		responses, err := servers.Request(NewRequest("POST", "/words", nil, c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(received) != 2 || received[0] != c.received || received[1] != c.received {
+			t.Errorf("expected %#v to send %q, got %q", c.body, c.received, received)
+		}
+
+		err = responses.StatusSame()
+		if err == nil {
+			t.Fatal("Expected error, but got none!")
+		}
+		msg := err.Error()
+		for _, s := range []string{"\n  # old\n  " + c.curl + "\n", "\n  # new\n  " + c.curl} {
+			if !strings.Contains(msg, s) {
+				t.Errorf("Did not get expected error string %q, got: %v", s, msg)
+			}
+		}
+	}
+}
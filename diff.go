@@ -0,0 +1,278 @@
+package congruent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultDiffContext is the number of unchanged lines shown around each change
+// in a diff
+const DefaultDiffContext = 3
+
+// DefaultDiffMaxHunks is the most hunks shown in a diff; the rest are counted
+// but left out
+const DefaultDiffMaxHunks = 5
+
+// DiffContext sets the number of unchanged lines shown around each change in
+// the diff of a failed body comparison
+func DiffContext(n int) ContentOption {
+	return func(c *contentConfig) {
+		c.diffContext = n
+	}
+}
+
+// DiffMaxHunks sets the most hunks shown in the diff of a failed body
+// comparison; zero or less shows them all
+func DiffMaxHunks(n int) ContentOption {
+	return func(c *contentConfig) {
+		c.diffMaxHunks = n
+	}
+}
+
+// prettyJSON indents JSON with its keys sorted, so that a line diff of two
+// documents lines up field by field; anything else is returned as it was
+func prettyJSON(b []byte) []byte {
+	var v interface{}
+	if err := unmarshalNumbers(bytes.TrimPrefix(b, utf8BOM), &v); err != nil {
+		return b
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return b
+	}
+
+	return buf.Bytes()
+}
+
+// bodyDiff renders a unified diff between two bodies, pretty-printing them
+// first when both are JSON; if that would hide the difference, as when they
+// differ only in formatting, the bodies are diffed as they are
+func bodyDiff(c *contentConfig, a, b []byte, from, to string) string {
+	pa, pb := prettyJSON(a), prettyJSON(b)
+	if bytes.Equal(pa, pb) {
+		pa, pb = a, b
+	}
+
+	return unifiedDiff(string(pa), string(pb), from, to, c.diffContext, c.diffMaxHunks)
+}
+
+type diffKind byte
+
+const (
+	diffEqual  diffKind = ' '
+	diffDelete diffKind = '-'
+	diffInsert diffKind = '+'
+)
+
+type diffLine struct {
+	kind diffKind
+	text string
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines finds a shortest edit script from a to b, by Myers' algorithm in
+// its linear space form: the middle snake of the shortest path is found by
+// searching from both ends at once, and the halves either side of it are
+// diffed in turn
+func diffLines(a, b []string) []diffLine {
+	size := len(a) + len(b) + 3
+	d := &lineDiff{a: a, b: b, vf: make([]int, size), vb: make([]int, size)}
+	d.compare(0, len(a), 0, len(b))
+
+	return d.lines
+}
+
+type lineDiff struct {
+	a, b   []string
+	vf, vb []int
+	lines  []diffLine
+}
+
+func (d *lineDiff) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.lines = append(d.lines, diffLine{diffEqual, d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aHi:
+		for _, l := range d.b[bLo:bHi] {
+			d.lines = append(d.lines, diffLine{diffInsert, l})
+		}
+	case bLo == bHi:
+		for _, l := range d.a[aLo:aHi] {
+			d.lines = append(d.lines, diffLine{diffDelete, l})
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		for _, l := range d.a[x:u] {
+			d.lines = append(d.lines, diffLine{diffEqual, l})
+		}
+		d.compare(u, aHi, v, bHi)
+	}
+
+	for _, l := range d.a[aHi : aHi+suffix] {
+		d.lines = append(d.lines, diffLine{diffEqual, l})
+	}
+}
+
+// middleSnake finds the snake in the middle of a shortest path from (aLo, bLo)
+// to (aHi, bHi), returning where it starts and ends. The paths from each end
+// are tracked by the furthest x reached on each diagonal, as offsets from
+// their own starting corner.
+func (d *lineDiff) middleSnake(aLo, aHi, bLo, bHi int) (x0, y0, x1, y1 int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	offset := m + 1
+	vf, vb := d.vf, d.vb
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		for k := -D; k <= D; k += 2 {
+			// diagonals which leave the grid can't be on the path
+			if k < -m || k > n {
+				continue
+			}
+			var x int
+			if k == -D || k == -m || (k != D && k != n && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+
+			if kr := delta - k; odd && kr >= -(D-1) && kr <= D-1 && kr >= -m && kr <= n && x+vb[offset+kr] >= n {
+				return aLo + sx, bLo + sy, aLo + x, bLo + y
+			}
+		}
+
+		for k := -D; k <= D; k += 2 {
+			if k < -m || k > n {
+				continue
+			}
+			var x int
+			if k == -D || k == -m || (k != D && k != n && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+
+			if kf := delta - k; !odd && kf >= -D && kf <= D && kf >= -m && kf <= n && x+vf[offset+kf] >= n {
+				return aHi - x, bHi - y, aHi - sx, bHi - sy
+			}
+		}
+	}
+
+	// unreachable, as the searches always meet
+	return aLo, bLo, aLo, bLo
+}
+
+// unifiedDiff renders the differences between two texts as a unified diff,
+// with `context` lines around each change and at most `maxHunks` hunks
+func unifiedDiff(a, b, from, to string, context, maxHunks int) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// group the changes into hunks, merging those whose context would overlap
+	type hunk struct{ start, end int }
+	var hunks []hunk
+	for i, l := range lines {
+		if l.kind == diffEqual {
+			continue
+		}
+		start, end := i-context, i+context+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if n := len(hunks); n > 0 && start <= hunks[n-1].end {
+			hunks[n-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+
+	if len(hunks) == 0 {
+		out.WriteString("(bodies differ only in line endings or a trailing newline)\n")
+		return out.String()
+	}
+
+	// line numbers in a and b at the start of every line of the script
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, l := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.kind != diffInsert {
+			aLine[i+1]++
+		}
+		if l.kind != diffDelete {
+			bLine[i+1]++
+		}
+	}
+
+	for i, h := range hunks {
+		if maxHunks > 0 && i == maxHunks {
+			fmt.Fprintf(&out, "... %d more hunks\n", len(hunks)-maxHunks)
+			break
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLine[h.start], aLine[h.end]-aLine[h.start]),
+			hunkRange(bLine[h.start], bLine[h.end]-bLine[h.start]))
+		for _, l := range lines[h.start:h.end] {
+			fmt.Fprintf(&out, "%c%s\n", l.kind, l.text)
+		}
+	}
+
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk; an empty hunk is placed
+// after the line before it, as `diff -u` does
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
@@ -0,0 +1,176 @@
+package congruent
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\nj\nk\n"
+
+	expected := `--- old
++++ new
+@@ -1,4 +1,4 @@
+ a
+-b
++B
+ c
+ d
+@@ -7,4 +7,4 @@
+ g
+ h
+-i
+ j
++k
+`
+	if d := unifiedDiff(a, b, "old", "new", 2, 0); d != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, d)
+	}
+
+	// with more context the hunks merge
+	if d := unifiedDiff(a, b, "old", "new", 3, 0); strings.Count(d, "@@ -") != 1 || !strings.Contains(d, "@@ -1,10 +1,10 @@") {
+		t.Errorf("expected a single hunk, got:\n%s", d)
+	}
+
+	d := unifiedDiff(a, b, "old", "new", 0, 1)
+	if strings.Count(d, "@@ -") != 1 || !strings.HasSuffix(d, "... 2 more hunks\n") {
+		t.Errorf("expected one hunk and a count of the rest, got:\n%s", d)
+	}
+	if !strings.Contains(d, "@@ -2 +2 @@\n-b\n+B\n") {
+		t.Errorf("unexpected hunk, got:\n%s", d)
+	}
+
+	// insertions at the start are placed after line 0
+	if d := unifiedDiff("b\n", "a\nb\n", "old", "new", 0, 0); !strings.Contains(d, "@@ -0,0 +1 @@\n+a\n") {
+		t.Errorf("unexpected hunk, got:\n%s", d)
+	}
+
+	if d := unifiedDiff("a\n", "a", "old", "new", 3, 0); !strings.Contains(d, "trailing newline") {
+		t.Errorf("expected a note on the trailing newline, got:\n%s", d)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	a := strings.Split("the quick brown fox jumps over the lazy dog", " ")
+	b := strings.Split("the slow brown fox walks over the dog", " ")
+
+	var kept, deleted, inserted []string
+	for _, l := range diffLines(a, b) {
+		switch l.kind {
+		case diffEqual:
+			kept = append(kept, l.text)
+		case diffDelete:
+			deleted = append(deleted, l.text)
+		case diffInsert:
+			inserted = append(inserted, l.text)
+		}
+	}
+
+	if s := strings.Join(kept, " "); s != "the brown fox over the dog" {
+		t.Errorf("unexpected common lines %q", s)
+	}
+	if len(deleted) != 3 || len(inserted) != 2 {
+		t.Errorf("expected 3 deletions and 2 insertions, got %v and %v", deleted, inserted)
+	}
+}
+
+// TestDiffLinesMinimal checks random scripts against the length of a longest
+// common subsequence, found by dynamic programming
+func TestDiffLinesMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(16))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(3)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+
+		var gotA, gotB []string
+		edits := 0
+		for _, l := range diffLines(a, b) {
+			if l.kind != diffInsert {
+				gotA = append(gotA, l.text)
+			}
+			if l.kind != diffDelete {
+				gotB = append(gotB, l.text)
+			}
+			if l.kind != diffEqual {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("script for %v to %v doesn't rebuild them", a, b)
+		}
+
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				switch {
+				case a[i] == b[j]:
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] > lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		if expected := len(a) + len(b) - 2*lcs[0][0]; edits != expected {
+			t.Fatalf("%v to %v: expected %d edits, got %d", a, b, expected, edits)
+		}
+	}
+}
+
+func TestBodyDiffs(t *testing.T) {
+	u, _ := url.Parse("http://localhost/")
+	mockReq := &http.Request{Method: "GET", URL: u}
+
+	var items []string
+	for i := 0; i < 40; i++ {
+		items = append(items, fmt.Sprintf(`{"id":%d,"name":"item %d"}`, i, i))
+	}
+	a := `{"items":[` + strings.Join(items, ",") + `],"total":40}`
+	items[30] = `{"id":30,"name":"changed"}`
+	b := `{"total":40,"items":[` + strings.Join(items, ",") + `]}`
+
+	responses := Responses{
+		&Response{Request: mockReq, Body: []byte(a), Server: &Server{Name: "old"}},
+		&Response{Request: mockReq, Body: []byte(b), Server: &Server{Name: "new"}},
+	}
+
+	for _, err := range []error{responses.BodySame(), responses.BodyContentSame()} {
+		if err == nil {
+			t.Fatal("Expected error, but got none!")
+		}
+		// the difference is near the end, where truncating the bodies would
+		// have hidden it
+		msg := err.Error()
+		if !strings.Contains(msg, "--- old\n+++ new\n") || !strings.Contains(msg, `-      "name": "item 30"`+"\n"+`+      "name": "changed"`) {
+			t.Errorf("Did not get expected error string, got: %v", msg)
+		}
+	}
+
+	err := responses.BodySameWith(DiffContext(0))
+	if err == nil || !strings.Contains(err.Error(), "@@ -125 +125 @@\n-      \"name\": \"item 30\"\n+      \"name\": \"changed\"\n") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	// bodies which only differ in formatting are diffed as they are
+	responses[0].Body, responses[1].Body = []byte(`{"a":1}`), []byte(`{"a": 1}`)
+	err = responses.BodySame()
+	if err == nil || !strings.Contains(err.Error(), "-{\"a\":1}\n+{\"a\": 1}\n") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
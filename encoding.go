@@ -0,0 +1,133 @@
+package congruent
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Decoder unwraps a stream encoded with a single content coding.
+type Decoder func(r io.Reader) (io.Reader, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		"gzip":    decodeGzip,
+		"x-gzip":  decodeGzip,
+		"deflate": decodeDeflate,
+		"br":      decodeBrotli,
+	}
+)
+
+// RegisterDecoder adds or replaces the Decoder used for a content coding, such
+// as "zstd". Registered codings are advertised in the `Accept-Encoding` header
+// of any Request that does not set its own; gzip, deflate and br are
+// registered already.
+func RegisterDecoder(coding string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[strings.ToLower(coding)] = d
+}
+
+func decodeGzip(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+func decodeBrotli(r io.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
+
+// decodeDeflate handles both the zlib-wrapped format the spec calls for, and
+// the raw deflate stream that some servers send instead.
+func decodeDeflate(r io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if zr, err := zlib.NewReader(bytes.NewReader(b)); err == nil {
+		return zr, nil
+	}
+
+	return flate.NewReader(bytes.NewReader(b)), nil
+}
+
+// acceptEncoding builds an `Accept-Encoding` value from the registered codings
+func acceptEncoding() string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	var codings []string
+	for c := range decoders {
+		if c == "x-gzip" {
+			continue
+		}
+		codings = append(codings, c)
+	}
+	sort.Strings(codings)
+
+	return strings.Join(codings, ", ")
+}
+
+// contentCodings splits a `Content-Encoding` value into its codings, in the
+// order they were applied; "identity" is dropped.
+func contentCodings(v string) []string {
+	var codings []string
+	for _, c := range strings.Split(v, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || c == "identity" {
+			continue
+		}
+		codings = append(codings, c)
+	}
+
+	return codings
+}
+
+// hasBody reports whether a response has a body to decode
+func hasBody(method string, status int, raw []byte) bool {
+	switch {
+	case len(raw) == 0, method == http.MethodHead:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+
+	return true
+}
+
+// decodeBody reverses each coding listed in a `Content-Encoding` value
+func decodeBody(encoding string, b []byte) ([]byte, error) {
+	codings := contentCodings(encoding)
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		decodersMu.RLock()
+		d, ok := decoders[codings[i]]
+		decodersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", codings[i])
+		}
+
+		r, err := d(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		if b, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,202 @@
+package congruent
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func compress(t *testing.T, coding string, b []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	}
+
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	expected := `{"ok":true}`
+
+	cases := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"", []byte(expected)},
+		{"identity", []byte(expected)},
+		{"gzip", compress(t, "gzip", []byte(expected))},
+		{"x-gzip", compress(t, "gzip", []byte(expected))},
+		{"deflate", compress(t, "deflate", []byte(expected))},
+		{"deflate", compress(t, "raw-deflate", []byte(expected))},
+		{"gzip, deflate", compress(t, "deflate", compress(t, "gzip", []byte(expected)))},
+		{"br", compress(t, "br", []byte(expected))},
+		{"gzip, br", compress(t, "br", compress(t, "gzip", []byte(expected)))},
+	}
+
+	for _, c := range cases {
+		b, err := decodeBody(c.encoding, c.body)
+		if err != nil {
+			t.Errorf("%s: %v", c.encoding, err)
+			continue
+		}
+		if string(b) != expected {
+			t.Errorf("%s: expected %s, got %s", c.encoding, expected, b)
+		}
+	}
+
+	if _, err := decodeBody("zstd", []byte(expected)); err == nil {
+		t.Error("Expected error for unregistered coding, but got none!")
+	}
+	if _, err := decodeBody("br", []byte("not really brotli")); err == nil {
+		t.Error("Expected error for a corrupt body, but got none!")
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder("X-Upper", func(r io.Reader) (io.Reader, error) {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(strings.ToLower(string(b))), nil
+	})
+	defer func() {
+		decodersMu.Lock()
+		delete(decoders, "x-upper")
+		decodersMu.Unlock()
+	}()
+
+	if ae := acceptEncoding(); ae != "br, deflate, gzip, x-upper" {
+		t.Errorf("unexpected Accept-Encoding %q", ae)
+	}
+
+	b, err := decodeBody("x-upper", []byte("ABC"))
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "abc" {
+		t.Errorf("expected abc, got %s", b)
+	}
+}
+
+func TestRequestDecodesBody(t *testing.T) {
+	body := []byte(strings.Repeat("congruent ", 100))
+	gzipped := compress(t, "gzip", body)
+
+	ts0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ae := r.Header.Get("Accept-Encoding"); !strings.Contains(ae, "gzip") {
+			t.Errorf("Expected gzip to be accepted, got %q", ae)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped)
+	}))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer ts1.Close()
+
+	request := NewRequest("GET", "/", nil, nil)
+	r0, err := request.Do(NewServer(ts0.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1, err := request.Do(NewServer(ts1.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := Responses{r0, r1}
+	if err := responses.BodySame(); err != nil {
+		t.Error(err)
+	}
+	if err := responses.ContentEncodingSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+
+	if r0.RawSize != len(gzipped) {
+		t.Errorf("expected raw size %d, got %d", len(gzipped), r0.RawSize)
+	}
+	if r1.RawSize != len(body) {
+		t.Errorf("expected raw size %d, got %d", len(body), r1.RawSize)
+	}
+	if e := r0.Headers.Get("Content-Encoding"); e != "gzip" {
+		t.Errorf("expected Content-Encoding header to be kept, got %q", e)
+	}
+}
+
+func TestRequestUnsupportedEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		fmt.Fprint(w, "not really zstd")
+	}))
+	defer ts.Close()
+
+	request := NewRequest("GET", "/", &http.Header{"Accept-Encoding": []string{"zstd"}}, nil)
+	if _, err := request.Do(NewServer(ts.URL, nil)); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestRequestEmptyEncodedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		switch r.URL.Path {
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		case "/empty":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Write(compress(t, "gzip", []byte("body")))
+		}
+	}))
+	defer ts.Close()
+
+	for _, r := range []*Request{
+		NewRequest("HEAD", "/", nil, nil),
+		NewRequest("GET", "/no-content", nil, nil),
+		NewRequest("GET", "/not-modified", nil, nil),
+		NewRequest("GET", "/empty", nil, nil),
+	} {
+		resp, err := r.Do(NewServer(ts.URL, nil))
+		if err != nil {
+			t.Errorf("(%s)%s: %v", r.Method, r.Path, err)
+			continue
+		}
+		if len(resp.Body) != 0 {
+			t.Errorf("(%s)%s: expected no body, got %q", r.Method, r.Path, resp.Body)
+		}
+	}
+}
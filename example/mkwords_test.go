@@ -110,26 +110,22 @@ func TestGenerateOptions(t *testing.T) {
 		t.Error(err)
 	}
 
-	for _, resp := range responses {
-		body := GenerateResponse{}
-		if err := json.Unmarshal(resp.Body, &body); err != nil {
-			t.Error(err)
-			t.Fail()
-		}
+	// rather than unmarshaling each body, the same checks can be made with
+	// path expressions, which are applied to every response
+	if err := responses.PathLen("$.result", 10); err != nil {
+		t.Error(err)
+	}
 
-		if l := len(body.Result); l != 10 {
-			t.Errorf("Expected 10 results, got %v", l)
-		}
+	if err := responses.PathEqual("$.ok", true); err != nil {
+		t.Error(err)
+	}
 
-		if !body.Ok {
-			t.Errorf("Expected OK to be true, got %v", body.Ok)
-		}
+	if err := responses.PathEqual("$.candidate-count", 21663); err != nil {
+		t.Error(err)
+	}
 
-		if body.CandidateCount != 21663 {
-			t.Errorf(
-				"Expected candidate_count to be 21663, got %v",
-				body.CandidateCount)
-		}
+	if err := responses.PathMatches("$.result[*]", "^.{10,20}$"); err != nil {
+		t.Error(err)
 	}
 }
 
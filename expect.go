@@ -0,0 +1,102 @@
+package congruent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Expectation collects the failures of a chain of checks over a set of
+// responses; every check is run, and Err reports all of the failures at once.
+//
+//	err := responses.Expect().
+//		Status(200).
+//		Header("Content-Type", "application/json").
+//		JSONSame().
+//		Within(time.Second).
+//		Err()
+type Expectation struct {
+	responses Responses
+	failures  []error
+}
+
+// Expect starts a chain of expectations over the responses
+func (r Responses) Expect() *Expectation {
+	return &Expectation{responses: r}
+}
+
+// That adds a user-defined check, which is run against the responses
+func (e *Expectation) That(a Assertion) *Expectation {
+	if err := a(e.responses); err != nil {
+		e.failures = append(e.failures, withoutReproduction(err))
+	}
+
+	return e
+}
+
+// Status expects every response to have the given status code
+func (e *Expectation) Status(status int) *Expectation {
+	return e.That(func(r Responses) error { return r.StatusEqual(status) })
+}
+
+// StatusSame expects every response to have the same status code
+func (e *Expectation) StatusSame() *Expectation {
+	return e.That(Responses.StatusSame)
+}
+
+// Header expects a header on every response to match the value `v`, which is
+// either a `string` or `[]string`
+func (e *Expectation) Header(k string, v interface{}) *Expectation {
+	return e.That(func(r Responses) error { return r.HeaderEqual(k, v) })
+}
+
+// HeaderSame expects every response to have the same headers
+func (e *Expectation) HeaderSame() *Expectation {
+	return e.That(Responses.HeaderSame)
+}
+
+// BodySame expects every response to have an identical body
+func (e *Expectation) BodySame() *Expectation {
+	return e.That(Responses.BodySame)
+}
+
+// JSONSame expects every response to have the same body content, as compared
+// by BodyContentSame
+func (e *Expectation) JSONSame(opts ...ContentOption) *Expectation {
+	return e.That(func(r Responses) error { return r.BodyContentSame(opts...) })
+}
+
+// Within expects every response to have been received within a duration
+func (e *Expectation) Within(d time.Duration) *Expectation {
+	return e.That(func(r Responses) error {
+		var errs []error
+		for _, resp := range r {
+			if resp.Duration > d {
+				errs = append(errs, fmt.Errorf(
+					"(%s)%s: Took %v, expected at most %v",
+					resp.Request.Method,
+					resp.Request.URL,
+					resp.Duration,
+					d))
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// Failures lists every expectation which failed, in the order they were made;
+// unlike Err, they don't include curl commands to reproduce the requests
+func (e *Expectation) Failures() []error {
+	return e.failures
+}
+
+// Err returns every failure joined into one error, followed by curl commands
+// to reproduce the requests, or nil if all of the expectations were met
+func (e *Expectation) Err() error {
+	if len(e.failures) == 0 {
+		return nil
+	}
+
+	return &MismatchError{Err: errors.Join(e.failures...), Responses: e.responses}
+}
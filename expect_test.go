@@ -0,0 +1,87 @@
+package congruent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpect(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"a":1,"b":[1,2]}`)
+	}
+	ts0 := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts1.Close()
+
+	servers := Servers{NewServer(ts0.URL, nil), NewServer(ts1.URL, nil)}
+	responses, err := servers.Request(NewRequest("GET", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resp := range responses {
+		if resp.Duration <= 0 {
+			t.Errorf("expected a duration, got %v", resp.Duration)
+		}
+	}
+
+	err = responses.Expect().
+		Status(200).
+		StatusSame().
+		Header("Content-Type", "application/json").
+		JSONSame().
+		BodySame().
+		Within(time.Minute).
+		Err()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExpectAggregatesFailures(t *testing.T) {
+	u0, _ := url.Parse("http://one/")
+	u1, _ := url.Parse("http://two/")
+	headers := &http.Header{"Content-Type": {"text/plain"}}
+	responses := Responses{
+		&Response{Request: &http.Request{Method: "GET", URL: u0}, Headers: headers, Body: []byte(`{"a":1}`), StatusCode: 200, Duration: time.Second},
+		&Response{Request: &http.Request{Method: "GET", URL: u1}, Headers: headers, Body: []byte(`{"a":2}`), StatusCode: 500},
+	}
+
+	custom := errors.New("custom failure")
+	e := responses.Expect().
+		Status(200).
+		Header("Content-Type", "text/plain").
+		JSONSame().
+		Within(time.Millisecond).
+		That(func(Responses) error { return custom })
+
+	if l := len(e.Failures()); l != 4 {
+		t.Errorf("expected 4 failures, got %d: %v", l, e.Failures())
+	}
+
+	err := e.Err()
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	if !errors.Is(err, custom) {
+		t.Error("expected the custom failure to be wrapped")
+	}
+	msg := err.Error()
+	for _, s := range []string{"Status was 500", "$.a: expected 1, was 2", "(GET)http://one/: Took 1s", "custom failure"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Did not get expected error string %q, got: %v", s, msg)
+		}
+	}
+	// the requests are reproduced once, after all of the failures
+	if strings.Count(msg, "reproduce with:") != 1 || !strings.HasSuffix(msg, "\n  # two\n  curl http://two/") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+}
@@ -0,0 +1,196 @@
+package congruent
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FuzzLocation is where in a request a fuzzed value is placed
+type FuzzLocation int
+
+const (
+	// FuzzQuery adds the value as a query parameter
+	FuzzQuery FuzzLocation = iota
+	// FuzzPath replaces a `{name}` placeholder in the path
+	FuzzPath
+	// FuzzHeader sets the value as a header
+	FuzzHeader
+	// FuzzBody sets the value as a field of the JSON object body
+	FuzzBody
+)
+
+// FuzzParam is a single fuzzed input. Seed is added to the seed corpus, and its
+// type decides the type the fuzzer generates; it must be one `testing.F`
+// supports, such as a string, []byte, bool, or a sized int or float.
+type FuzzParam struct {
+	Name string
+	In   FuzzLocation
+	Seed interface{}
+}
+
+// FuzzTemplate maps fuzzer inputs onto a Request. Body, if set, must be an
+// object; FuzzBody params are set as fields on a copy of it.
+type FuzzTemplate struct {
+	Method  string
+	Path    string
+	Headers *http.Header
+	Body    map[string]interface{}
+	Params  []FuzzParam
+}
+
+// Request builds the request for a set of values, one per param in order. It
+// returns an error for values which can't be sent, like a header containing a
+// newline.
+func (ft *FuzzTemplate) Request(values ...interface{}) (*Request, error) {
+	if len(values) != len(ft.Params) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(ft.Params), len(values))
+	}
+
+	p := ft.Path
+	query := url.Values{}
+	headers := http.Header{}
+	if ft.Headers != nil {
+		for k, v := range *ft.Headers {
+			headers[k] = append([]string(nil), v...)
+		}
+	}
+
+	var body interface{}
+	if ft.Body != nil {
+		b := map[string]interface{}{}
+		for k, v := range ft.Body {
+			b[k] = v
+		}
+		body = b
+	}
+
+	for i, param := range ft.Params {
+		v := values[i]
+		if b, ok := v.([]byte); ok && param.In != FuzzBody {
+			v = string(b)
+		}
+
+		switch param.In {
+		case FuzzQuery:
+			query.Add(param.Name, fmt.Sprint(v))
+		case FuzzPath:
+			p = strings.Replace(p, "{"+param.Name+"}", url.PathEscape(fmt.Sprint(v)), -1)
+		case FuzzHeader:
+			hv := fmt.Sprint(v)
+			if strings.IndexFunc(hv, invalidHeaderRune) >= 0 {
+				return nil, fmt.Errorf("invalid value %q for header %s", hv, param.Name)
+			}
+			headers.Set(param.Name, hv)
+		case FuzzBody:
+			if body == nil {
+				body = map[string]interface{}{}
+			}
+			body.(map[string]interface{})[param.Name] = v
+		default:
+			return nil, fmt.Errorf("unknown location %d for %s", param.In, param.Name)
+		}
+	}
+
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(p, "?") {
+			sep = "&"
+		}
+		p += sep + query.Encode()
+	}
+
+	if body == nil {
+		body = ""
+	}
+
+	return NewRequest(ft.Method, p, &headers, body), nil
+}
+
+// Fuzz runs a differential fuzz test: every input the fuzzer generates is
+// mapped onto the template, sent to all servers, and the test fails when any
+// assertion does. With no assertions, the servers must agree on status and
+// body content. Call it from a `FuzzXxx` function, and run it with
+// `go test -fuzz`; without `-fuzz`, only the seeds are tried.
+func Fuzz(f *testing.F, s Servers, ft *FuzzTemplate, assertions ...Assertion) {
+	f.Helper()
+
+	if len(assertions) == 0 {
+		assertions = defaultAssertions()
+	}
+
+	args := []reflect.Type{reflect.TypeOf((*testing.T)(nil))}
+	seeds := make([]interface{}, len(ft.Params))
+	for i, param := range ft.Params {
+		if param.Seed == nil {
+			f.Fatalf("fuzz param %s has no seed", param.Name)
+		}
+		args = append(args, reflect.TypeOf(param.Seed))
+		seeds[i] = param.Seed
+	}
+	f.Add(seeds...)
+
+	// testing.F only accepts a function whose arguments match the seeds, so
+	// one is built to suit the template
+	fn := reflect.MakeFunc(reflect.FuncOf(args, nil, false), func(in []reflect.Value) []reflect.Value {
+		t := in[0].Interface().(*testing.T)
+		t.Helper()
+
+		values := make([]interface{}, len(in)-1)
+		for i, v := range in[1:] {
+			values[i] = v.Interface()
+		}
+
+		// inputs which can't be sent at all aren't interesting
+		req, err := ft.Request(values...)
+		if err != nil {
+			t.Skip(err)
+		}
+		if err := differ(s, req, assertions); err != nil {
+			t.Error(err)
+		}
+
+		return nil
+	})
+
+	f.Fuzz(fn.Interface())
+}
+
+// defaultAssertions are used when a differential test is given none: the
+// servers must agree on status and body content
+func defaultAssertions() []Assertion {
+	return []Assertion{
+		Responses.StatusSame,
+		func(r Responses) error { return r.BodyContentSame() },
+	}
+}
+
+// invalidHeaderRune reports whether a rune can't be sent in a header value
+func invalidHeaderRune(r rune) bool {
+	return (r < ' ' && r != '\t') || r == 0x7f
+}
+
+// differ sends a request to all servers and returns the failures of every
+// assertion, or nil if the servers agreed
+func differ(s Servers, req *Request, assertions []Assertion) error {
+	responses, err := s.Request(req)
+	if err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, a := range assertions {
+		if err := a(responses); err != nil {
+			failures = append(failures, withoutReproduction(err).Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("servers disagreed on (%s)%s:\n%s\n%s", req.Method, req.Path, strings.Join(failures, "\n"), reproduce(responses))
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":  r.URL.Path,
+		"q":     r.URL.Query().Get("q"),
+		"token": r.Header.Get("X-Token"),
+		"body":  body,
+	})
+}
+
+var testFuzzTemplate = &FuzzTemplate{
+	Method: "POST",
+	Path:   "words/{id}?static=1",
+	Body:   map[string]interface{}{"fixed": true},
+	Params: []FuzzParam{
+		{Name: "id", In: FuzzPath, Seed: "a b"},
+		{Name: "q", In: FuzzQuery, Seed: "x&y"},
+		{Name: "X-Token", In: FuzzHeader, Seed: []byte("secret")},
+		{Name: "count", In: FuzzBody, Seed: int64(3)},
+	},
+}
+
+func TestFuzzTemplateRequest(t *testing.T) {
+	req, err := testFuzzTemplate.Request("a b", "x&y", []byte("secret"), int64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Path != "words/a%20b?static=1&q=x%26y" {
+		t.Errorf("unexpected path %s", req.Path)
+	}
+	if v := req.Headers.Get("X-Token"); v != "secret" {
+		t.Errorf("unexpected header %s", v)
+	}
+	body, _ := json.Marshal(req.Body)
+	if string(body) != `{"count":3,"fixed":true}` {
+		t.Errorf("unexpected body %s", body)
+	}
+	if _, ok := testFuzzTemplate.Body["count"]; ok {
+		t.Error("expected the template body to be left alone")
+	}
+
+	if _, err := testFuzzTemplate.Request("a"); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+	if _, err := testFuzzTemplate.Request("a", "b", []byte("bad\nvalue"), int64(1)); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestDiffer(t *testing.T) {
+	ts0 := httptest.NewServer(http.HandlerFunc(echoHandler))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "boom" {
+			w.WriteHeader(500)
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		echoHandler(w, r)
+	}))
+	defer ts1.Close()
+
+	servers := Servers{NewServer(ts0.URL+"/", nil), NewServer(ts1.URL+"/", nil)}
+	assertions := []Assertion{Responses.StatusSame, Responses.BodySame}
+
+	req, _ := testFuzzTemplate.Request("a", "fine", []byte("t"), int64(1))
+	if err := differ(servers, req, assertions); err != nil {
+		t.Error(err)
+	}
+
+	req, _ = testFuzzTemplate.Request("a", "boom", []byte("t"), int64(1))
+	err := differ(servers, req, assertions)
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	// every assertion is reported, not just the first
+	if msg := err.Error(); !strings.Contains(msg, "Status was") || !strings.Contains(msg, "Body differed") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+	// followed by a way to reproduce it
+	if msg := err.Error(); !strings.Contains(msg, "\nreproduce with:\n  # "+ts0.URL+"/\n  curl ") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+}
+
+func FuzzEcho(f *testing.F) {
+	ts0 := httptest.NewServer(http.HandlerFunc(echoHandler))
+	f.Cleanup(ts0.Close)
+	ts1 := httptest.NewServer(http.HandlerFunc(echoHandler))
+	f.Cleanup(ts1.Close)
+
+	servers := Servers{NewServer(ts0.URL+"/", nil), NewServer(ts1.URL+"/", nil)}
+	Fuzz(f, servers, testFuzzTemplate)
+}
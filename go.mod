@@ -0,0 +1,5 @@
+module github.com/fardog/congruent
+
+go 1.24
+
+require github.com/andybalholm/brotli v1.2.6
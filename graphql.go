@@ -0,0 +1,203 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// graphQLBody is the standard body of a GraphQL request over HTTP
+type graphQLBody struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// NewGraphQLRequest creates a new request which POSTs a GraphQL operation to
+// the given path. A `Content-Type` of `application/json` is added unless the
+// given headers already set one.
+func NewGraphQLRequest(p string, h *http.Header, query string, vars map[string]interface{}, op string) *Request {
+	headers := http.Header{}
+	if h != nil {
+		mergeHTTPHeader(&headers, h)
+	}
+	if headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", "application/json")
+	}
+
+	return NewRequest("POST", p, &headers, &graphQLBody{query, vars, op})
+}
+
+// graphQLResponse is the standard shape of a GraphQL response body
+type graphQLResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []graphQLError `json:"errors"`
+}
+
+type graphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// String describes an error by the parts that GraphQLErrorsSame compares
+func (e graphQLError) String() string {
+	s := fmt.Sprintf("%q", e.Message)
+	if len(e.Path) > 0 {
+		s += " at " + formatLocation(e.Path)
+	}
+	if code, ok := e.Extensions["code"]; ok {
+		s += fmt.Sprintf(" (code %v)", code)
+	}
+
+	return s
+}
+
+func (e graphQLError) equal(o graphQLError) bool {
+	return e.String() == o.String()
+}
+
+func decodeGraphQL(resp *Response) (*graphQLResponse, error) {
+	var gr graphQLResponse
+	if err := unmarshalNumbers(resp.Body, &gr); err != nil {
+		return nil, fmt.Errorf(
+			"(%s)%s: Response was not a GraphQL response: %v",
+			resp.Request.Method, resp.Request.URL, err)
+	}
+
+	// paths mix field names and list indexes; make the indexes ints so that
+	// they format the same way as any other location
+	for i := range gr.Errors {
+		for j, elem := range gr.Errors[i].Path {
+			if n, ok := elem.(json.Number); ok {
+				if index, err := n.Int64(); err == nil {
+					gr.Errors[i].Path[j] = int(index)
+				}
+			}
+		}
+	}
+
+	return &gr, nil
+}
+
+func (r Responses) decodeGraphQL() ([]*graphQLResponse, error) {
+	var decoded []*graphQLResponse
+	for _, resp := range r {
+		gr, err := decodeGraphQL(resp)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, gr)
+	}
+
+	return decoded, nil
+}
+
+// GraphQLNoErrors verifies that no response carried GraphQL errors. GraphQL
+// servers usually report errors with a `200` status, so StatusEqual alone won't
+// catch them.
+func (r Responses) GraphQLNoErrors() (err error) {
+	defer r.reproducible(&err)
+
+	decoded, err := r.decodeGraphQL()
+	if err != nil {
+		return err
+	}
+
+	for i, gr := range decoded {
+		if len(gr.Errors) > 0 {
+			var errs []string
+			for _, e := range gr.Errors {
+				errs = append(errs, e.String())
+			}
+			return fmt.Errorf(
+				"(%s)%s: Status was %d, but response had %d errors: %s",
+				r[i].Request.Method, r[i].Request.URL, r[i].StatusCode,
+				len(gr.Errors), strings.Join(errs, "; "))
+		}
+	}
+
+	return nil
+}
+
+// GraphQLErrorsSame verifies that every response carried the same GraphQL
+// errors, in the same order. Errors are compared by message, path and
+// `extensions.code`; locations in the query are ignored, since those change
+// with formatting.
+func (r Responses) GraphQLErrorsSame() (err error) {
+	defer r.reproducible(&err)
+
+	decoded, err := r.decodeGraphQL()
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i < len(decoded); i++ {
+		prev, cur := decoded[i-1].Errors, decoded[i].Errors
+		method, url := r[i].Request.Method, r[i].Request.URL
+
+		switch {
+		case len(prev) == 0 && len(cur) > 0:
+			return fmt.Errorf(
+				"(%s)%s: Response had %d errors, expected none; first was %s",
+				method, url, len(cur), cur[0])
+		case len(prev) > 0 && len(cur) == 0:
+			return fmt.Errorf(
+				"(%s)%s: Response had no errors, expected %d; first was %s",
+				method, url, len(prev), prev[0])
+		case len(prev) != len(cur):
+			return fmt.Errorf(
+				"(%s)%s: Response had %d errors, expected %d", method, url, len(cur), len(prev))
+		}
+
+		for j := range cur {
+			if !cur[j].equal(prev[j]) {
+				return fmt.Errorf(
+					"(%s)%s: Expected error %d to be %s, was %s", method, url, j, prev[j], cur[j])
+			}
+		}
+	}
+
+	return nil
+}
+
+// GraphQLDataSame verifies that the `data` of every response is the same,
+// compared field by field as BodyContentSame would; paths given to
+// IgnorePaths are relative to `data`.
+func (r Responses) GraphQLDataSame(opts ...ContentOption) (err error) {
+	defer r.reproducible(&err)
+
+	c, err := newContentConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := r.decodeGraphQL()
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i < len(decoded); i++ {
+		if m := compareContent(c, nil, decoded[i-1].Data, decoded[i].Data); m != nil {
+			return fmt.Errorf("(%s)%s: data %s", r[i].Request.Method, r[i].Request.URL, m)
+		}
+	}
+
+	return nil
+}
+
+// GraphQLSame verifies that all responses agree on status, errors and data, in
+// that order, returning the first difference found.
+func (r Responses) GraphQLSame(opts ...ContentOption) (err error) {
+	defer r.reproducible(&err)
+
+	if err := r.StatusSame(); err != nil {
+		return err
+	}
+	if err := r.GraphQLErrorsSame(); err != nil {
+		return err
+	}
+
+	return r.GraphQLDataSame(opts...)
+}
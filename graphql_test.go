@@ -0,0 +1,100 @@
+package congruent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewGraphQLRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Authorization") != "token" {
+			t.Error("expected given headers to be kept")
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Error(err)
+		}
+		if body["operationName"] != "Item" || body["variables"].(map[string]interface{})["id"] != "1" {
+			t.Errorf("unexpected body %s", b)
+		}
+	}))
+	defer ts.Close()
+
+	h := &http.Header{"Authorization": []string{"token"}}
+	request := NewGraphQLRequest("/", h, "query Item($id: ID!) { item(id: $id) { name } }",
+		map[string]interface{}{"id": "1"}, "Item")
+
+	if _, err := request.Do(NewServer(ts.URL, nil)); err != nil {
+		t.Error(err)
+	}
+	if h.Get("Content-Type") != "" {
+		t.Error("expected given headers not to be modified")
+	}
+}
+
+func TestGraphQLErrorsSame(t *testing.T) {
+	responses := mockResponses(
+		`{"data":null,"errors":[{"message":"nope","path":["item",0],"locations":[{"line":1,"column":2}],"extensions":{"code":"NOT_FOUND"}}]}`,
+		`{"errors":[{"message":"nope","path":["item",0],"locations":[{"line":4,"column":7}],"extensions":{"code":"NOT_FOUND","trace":"x"}}]}`)
+
+	if err := responses.GraphQLErrorsSame(); err != nil {
+		t.Error(err)
+	}
+	if err := responses.GraphQLNoErrors(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "Status was 200") || !strings.Contains(err.Error(), "$.item[0]") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	responses = mockResponses(
+		`{"errors":[{"message":"nope","extensions":{"code":"NOT_FOUND"}}]}`,
+		`{"errors":[{"message":"nope","extensions":{"code":"FORBIDDEN"}}]}`)
+	if err := responses.GraphQLErrorsSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+
+	responses = mockResponses(
+		`{"data":{"item":{"name":"a"}}}`,
+		`{"data":{"item":null},"errors":[{"message":"boom"}]}`)
+	if err := responses.GraphQLErrorsSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "expected none") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestGraphQLDataSame(t *testing.T) {
+	responses := mockResponses(
+		`{"data":{"item":{"name":"a","id":"1"}}}`,
+		`{"data":{"item":{"id":"1","name":"a"}},"extensions":{"cost":3}}`)
+
+	if err := responses.GraphQLSame(); err != nil {
+		t.Error(err)
+	}
+
+	responses = mockResponses(
+		`{"data":{"item":{"name":"a","id":"1"}}}`,
+		`{"data":{"item":{"name":"b","id":"1"}}}`)
+	if err := responses.GraphQLDataSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "$.item.name") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+	if err := responses.GraphQLDataSame(IgnorePaths("$.item.name")); err != nil {
+		t.Error(err)
+	}
+
+	responses = mockResponses(`{"data":{}}`, `<html>`)
+	if err := responses.GraphQLDataSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
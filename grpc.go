@@ -0,0 +1,307 @@
+package congruent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fardog/congruent/urljoin"
+)
+
+// grpcClient speaks HTTP/2 to every server; over TLS it's negotiated, and over
+// plain HTTP it's assumed, as gRPC servers don't support upgrading.
+var (
+	grpcClientOnce sync.Once
+	grpcClient     *http.Client
+)
+
+func getGRPCClient() *http.Client {
+	grpcClientOnce.Do(func() {
+		var p http.Protocols
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+		grpcClient = &http.Client{Transport: &http.Transport{Protocols: &p}}
+	})
+
+	return grpcClient
+}
+
+// grpcStatusNames are the canonical names of gRPC status codes
+var grpcStatusNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+func grpcStatusName(code int) string {
+	if code >= 0 && code < len(grpcStatusNames) {
+		return grpcStatusNames[code]
+	}
+
+	return "UNKNOWN"
+}
+
+// NewGRPCRequest creates a new unary gRPC call to be made against a Server.
+// The method is named as `pkg.Service/Method`, and the message is anything that
+// marshals to a JSON object matching the method's input type.
+func NewGRPCRequest(ds *DescriptorSet, m string, md *http.Header, msg interface{}) *GRPCRequest {
+	return &GRPCRequest{ds, m, md, msg}
+}
+
+// GRPCRequest represents a unary gRPC call to be made. Messages are built from
+// the DescriptorSet at call time, so no generated code is needed.
+type GRPCRequest struct {
+	Descriptors *DescriptorSet
+	Method      string
+	Metadata    *http.Header
+	Message     interface{}
+}
+
+// GRPCResponse represents the result of a unary gRPC call. Message is decoded
+// using the protobuf JSON mapping, and is nil when the call failed.
+type GRPCResponse struct {
+	Request       *http.Request
+	Headers       *http.Header
+	Trailers      *http.Header
+	Status        int
+	StatusMessage string
+	Message       map[string]interface{}
+}
+
+// GRPCResponses is an array of GRPCResponse pointers
+type GRPCResponses []*GRPCResponse
+
+// Do performs a GRPCRequest and returns a GRPCResponse. A non-OK gRPC status is
+// not an error here; it's reported in the response, to be asserted against.
+func (r GRPCRequest) Do(s *Server) (*GRPCResponse, error) {
+	md, in, out, err := r.Descriptors.method(r.Method)
+	if err != nil {
+		return nil, err
+	}
+	if md.clientStreaming || md.serverStreaming {
+		return nil, fmt.Errorf("%s is a streaming method; only unary calls are supported", md.name)
+	}
+
+	msg, err := in.marshal(r.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	// length-prefixed message: an uncompressed flag, then a 4 byte length
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	uri := urljoin.Join(s.BaseURI, md.name)
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+
+	mergeHTTPHeaders(&req.Header, s.Headers, r.Metadata)
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	if err := s.rewrite(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := getGRPCClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// a "trailers-only" response carries its status in the headers instead
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return nil, fmt.Errorf(
+			"(%s)%s: Response had no grpc-status; HTTP status was %d",
+			req.Method, req.URL, resp.StatusCode)
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, fmt.Errorf("(%s)%s: Invalid grpc-status %q", req.Method, req.URL, status)
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+
+	gr := &GRPCResponse{
+		Request:       req,
+		Headers:       &resp.Header,
+		Trailers:      &resp.Trailer,
+		Status:        code,
+		StatusMessage: message,
+	}
+
+	if code == 0 {
+		if len(body) < 5 {
+			return nil, fmt.Errorf("(%s)%s: Response had no message", req.Method, req.URL)
+		}
+		if body[0] != 0 {
+			return nil, fmt.Errorf("(%s)%s: Compressed messages are not supported", req.Method, req.URL)
+		}
+		l := binary.BigEndian.Uint32(body[1:5])
+		if uint32(len(body)-5) < l {
+			return nil, fmt.Errorf("(%s)%s: Response message was truncated", req.Method, req.URL)
+		}
+
+		if gr.Message, err = out.unmarshal(body[5 : 5+l]); err != nil {
+			return nil, fmt.Errorf("(%s)%s: %v", req.Method, req.URL, err)
+		}
+	}
+
+	return gr, nil
+}
+
+// GRPC makes a unary gRPC call against a list of servers, and returns responses
+// in the same order as the servers
+func (s Servers) GRPC(r *GRPCRequest) (GRPCResponses, error) {
+	responses := make(GRPCResponses, len(s))
+	err := s.each(func(i int, server *Server) (err error) {
+		responses[i], err = r.Do(server)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
+
+// StatusSame verifies that all calls ended with the same gRPC status code;
+// returns an error for the first mismatch, if not.
+func (r GRPCResponses) StatusSame() error {
+	if len(r) < 1 {
+		return nil
+	}
+
+	return r.StatusEqual(r[0].Status)
+}
+
+// StatusEqual verifies that all calls ended with a given gRPC status code;
+// returns an error for the first mismatch, if not.
+func (r GRPCResponses) StatusEqual(code int) error {
+	for _, resp := range r {
+		if resp.Status != code {
+			return fmt.Errorf(
+				"(%s)%s: gRPC status was %d %s (%q), expected %d %s",
+				resp.Request.Method, resp.Request.URL,
+				resp.Status, grpcStatusName(resp.Status), resp.StatusMessage,
+				code, grpcStatusName(code))
+		}
+	}
+
+	return nil
+}
+
+// transportHeaders are left out of MetadataSame unless asked for by name
+var transportHeaders = map[string]bool{
+	"Content-Length": true,
+	"Content-Type":   true,
+	"Date":           true,
+	"Grpc-Message":   true,
+	"Grpc-Status":    true,
+	"Trailer":        true,
+}
+
+func (r *GRPCResponse) metadata() http.Header {
+	md := http.Header{}
+	for _, h := range []*http.Header{r.Headers, r.Trailers} {
+		if h == nil {
+			continue
+		}
+		for k, v := range *h {
+			md[k] = append(md[k], v...)
+		}
+	}
+
+	return md
+}
+
+// MetadataSame verifies that the response metadata, from both headers and
+// trailers, matches for all calls. When keys are given, only those are
+// compared; otherwise all metadata is, apart from HTTP transport headers.
+func (r GRPCResponses) MetadataSame(keys ...string) error {
+	if len(r) < 2 {
+		return nil
+	}
+
+	for i, resp := range r[1:] {
+		a, b := r[i].metadata(), resp.metadata()
+
+		compare := keys
+		if len(compare) == 0 {
+			seen := map[string]bool{}
+			for _, h := range []http.Header{a, b} {
+				for k := range h {
+					if !transportHeaders[k] && !seen[k] {
+						seen[k] = true
+						compare = append(compare, k)
+					}
+				}
+			}
+			sort.Strings(compare)
+		}
+
+		for _, k := range compare {
+			k = http.CanonicalHeaderKey(k)
+			if av, bv := strings.Join(a[k], ", "), strings.Join(b[k], ", "); av != bv {
+				return fmt.Errorf(
+					"(%s)%s: Expected metadata %v to have value %q, was %q",
+					resp.Request.Method, resp.Request.URL, k, av, bv)
+			}
+		}
+	}
+
+	return nil
+}
+
+// MessageSame verifies that the decoded response messages are the same for
+// all calls, field by field; ContentOptions such as IgnorePaths apply as they
+// do to BodyContentSame, using the JSON names of fields.
+func (r GRPCResponses) MessageSame(opts ...ContentOption) error {
+	if len(r) < 2 {
+		return nil
+	}
+
+	c, err := newContentConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	for i, resp := range r[1:] {
+		var a, b interface{}
+		if r[i].Message != nil {
+			a = r[i].Message
+		}
+		if resp.Message != nil {
+			b = resp.Message
+		}
+
+		if m := compareContent(c, nil, a, b); m != nil {
+			return fmt.Errorf("(%s)%s: %s", resp.Request.Method, resp.Request.URL, m)
+		}
+	}
+
+	return nil
+}
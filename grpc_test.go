@@ -0,0 +1,185 @@
+package congruent
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// grpcServer serves test.Items/Get over unencrypted HTTP/2, replying with the
+// message returned by handle, or with the status it returns if non-zero
+func grpcServer(t *testing.T, ds *DescriptorSet, handle func(in map[string]interface{}) (map[string]interface{}, int)) *httptest.Server {
+	item := ds.messages["test.Item"]
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != "/test.Items/Get" {
+			t.Errorf("unexpected request %s %s", r.Proto, r.URL.Path)
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		in, err := item.unmarshal(body[5:])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("X-Server", r.Host)
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+		out, status := handle(in)
+		if status == 0 {
+			msg, err := item.marshal(out)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			frame := make([]byte, 5)
+			binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+			w.Write(append(frame, msg...))
+		}
+
+		w.Header().Set("Grpc-Status", string(rune('0'+status)))
+		w.Header().Set("Grpc-Message", "not%20found")
+	}))
+
+	var p http.Protocols
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &p
+	ts.Start()
+
+	return ts
+}
+
+func TestGRPC(t *testing.T) {
+	ds := testDescriptorSet(t)
+
+	ts0 := grpcServer(t, ds, func(in map[string]interface{}) (map[string]interface{}, int) {
+		return map[string]interface{}{"id": in["id"], "displayName": "widget", "price": 19.99}, 0
+	})
+	defer ts0.Close()
+	ts1 := grpcServer(t, ds, func(in map[string]interface{}) (map[string]interface{}, int) {
+		// sending defaults explicitly shouldn't matter
+		return map[string]interface{}{"id": in["id"], "display_name": "widget", "price": 19.99, "delta": 0}, 0
+	})
+	defer ts1.Close()
+	ts2 := grpcServer(t, ds, func(in map[string]interface{}) (map[string]interface{}, int) {
+		return map[string]interface{}{"id": in["id"], "displayName": "gadget", "price": 19.99}, 0
+	})
+	defer ts2.Close()
+	ts3 := grpcServer(t, ds, func(in map[string]interface{}) (map[string]interface{}, int) {
+		return nil, 5
+	})
+	defer ts3.Close()
+
+	request := NewGRPCRequest(ds, "test.Items/Get", nil, map[string]interface{}{"id": 42})
+
+	servers := Servers{NewServer(ts0.URL, nil), NewServer(ts1.URL, nil)}
+	responses, err := servers.GRPC(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.StatusEqual(0); err != nil {
+		t.Error(err)
+	}
+	if err := responses.MessageSame(); err != nil {
+		t.Error(err)
+	}
+	if id := fmt.Sprint(responses[0].Message["id"]); id != "42" {
+		t.Errorf("expected id to be echoed, got %v", id)
+	}
+	if err := responses.MetadataSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+	if err := responses.MetadataSame("Content-Type"); err != nil {
+		t.Error(err)
+	}
+
+	servers = Servers{NewServer(ts0.URL, nil), NewServer(ts2.URL, nil)}
+	responses, err = servers.GRPC(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.MessageSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "$.displayName") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+	if err := responses.MessageSame(IgnorePaths("$.displayName")); err != nil {
+		t.Error(err)
+	}
+
+	servers = Servers{NewServer(ts0.URL, nil), NewServer(ts3.URL, nil)}
+	responses, err = servers.GRPC(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.StatusSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "NOT_FOUND") || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestGRPCKeepsServerOrder(t *testing.T) {
+	ds := testDescriptorSet(t)
+
+	var servers Servers
+	for _, delay := range []time.Duration{30, 0, 15} {
+		d := delay * time.Millisecond
+		ts := grpcServer(t, ds, func(in map[string]interface{}) (map[string]interface{}, int) {
+			time.Sleep(d)
+			return map[string]interface{}{"id": in["id"]}, 0
+		})
+		defer ts.Close()
+		servers = append(servers, NewServer(ts.URL, nil))
+	}
+
+	responses, err := servers.GRPC(NewGRPCRequest(ds, "test.Items/Get", nil, map[string]interface{}{"id": 42}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, resp := range responses {
+		if "http://"+resp.Request.URL.Host != servers[i].BaseURI {
+			t.Errorf("response %d came from the wrong server: %s", i, resp.Request.URL)
+		}
+	}
+}
+
+func TestGRPCMiddleware(t *testing.T) {
+	ds := testDescriptorSet(t)
+	ts := grpcServer(t, ds, func(in map[string]interface{}) (map[string]interface{}, int) {
+		return map[string]interface{}{"id": in["id"]}, 0
+	})
+	defer ts.Close()
+
+	// the server only answers /test.Items/Get, so the prefix must be removed
+	server := &Server{BaseURI: ts.URL + "/rpc", Middleware: []Middleware{RewritePath("/rpc/", "/")}}
+	req := NewGRPCRequest(ds, "test.Items/Get", nil, map[string]interface{}{"id": 42})
+
+	resp, err := req.Do(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Request.URL.Path != "/test.Items/Get" || resp.Status != 0 {
+		t.Errorf("unexpected response %s %d", resp.Request.URL, resp.Status)
+	}
+
+	server.Middleware = []Middleware{func(req *http.Request) error { return fmt.Errorf("bad request") }}
+	if _, err := req.Do(server); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if err.Error() != "(POST)"+ts.URL+"/rpc/test.Items/Get: bad request" {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package congruent
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Table is a set of rows of named parameters, for filling in a Template
+type Table []map[string]interface{}
+
+// placeholder matches a `{name}` placeholder in a Template
+var placeholder = regexp.MustCompile(`\{([A-Za-z0-9_.-]+)\}`)
+
+// Template is a Request with `{name}` placeholders, which are filled in from
+// each row of a Table. Placeholders in the path are escaped for where they
+// appear: as a path segment, or after the `?` as a query value. A string in
+// Body which is only a placeholder is replaced by the row's value as it is, so
+// that numbers stay numbers; anywhere else, values are formatted as text.
+type Template struct {
+	Method  string
+	Path    string
+	Headers *http.Header
+	Body    interface{}
+}
+
+// Expand fills in the template from every row of the table, returning one
+// Request per row, named after the row's parameters. It is an error for a
+// placeholder to have no value in a row.
+func (t *Template) Expand(table Table) (Requests, error) {
+	var requests Requests
+	for i, row := range table {
+		r, err := t.expand(row)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, nil
+}
+
+func (t *Template) expand(row map[string]interface{}) (*Request, error) {
+	var missing []string
+	fill := func(s string, escape func(string) string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[1 : len(m)-1]
+			v, ok := row[name]
+			if !ok {
+				missing = append(missing, name)
+				return m
+			}
+			if escape != nil {
+				return escape(paramString(v))
+			}
+			return paramString(v)
+		})
+	}
+
+	p := t.Path
+	query := ""
+	if i := strings.Index(p, "?"); i >= 0 {
+		p, query = p[:i], p[i:]
+	}
+	p = fill(p, url.PathEscape) + fill(query, url.QueryEscape)
+
+	var headers *http.Header
+	if t.Headers != nil {
+		h := http.Header{}
+		for k, va := range *t.Headers {
+			for _, v := range va {
+				h.Add(k, fill(v, nil))
+			}
+		}
+		headers = &h
+	}
+
+	var fillBody func(v interface{}) interface{}
+	fillBody = func(v interface{}) interface{} {
+		switch value := v.(type) {
+		case string:
+			if m := placeholder.FindStringSubmatch(value); m != nil && m[0] == value {
+				if rv, ok := row[m[1]]; ok {
+					return rv
+				}
+			}
+			return fill(value, nil)
+		case map[string]interface{}:
+			filled := make(map[string]interface{}, len(value))
+			for k, child := range value {
+				filled[fill(k, nil)] = fillBody(child)
+			}
+			return filled
+		case []interface{}:
+			filled := make([]interface{}, len(value))
+			for i, child := range value {
+				filled[i] = fillBody(child)
+			}
+			return filled
+		}
+		return v
+	}
+
+	// a plain string body is filled in as text; anything else as JSON
+	body := t.Body
+	if s, ok := body.(string); ok {
+		body = fill(s, nil)
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		var decoded interface{}
+		if err := unmarshalNumbers(b, &decoded); err != nil {
+			return nil, err
+		}
+		body = fillBody(decoded)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no value for %s", strings.Join(missing, ", "))
+	}
+
+	r := NewRequest(t.Method, p, headers, body)
+	r.Name = rowName(row)
+
+	return r, nil
+}
+
+// rowName names a case after its parameters, like `id=42,lang=en`
+func rowName(row map[string]interface{}) string {
+	keys := make([]string, 0, len(row))
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+paramString(row[k]))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// ParseTableCSV reads a table from CSV; the first record names the columns,
+// and every value is a string
+func ParseTableCSV(r io.Reader) (Table, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV table has no header")
+	}
+
+	header := records[0]
+	var table Table
+	for _, record := range records[1:] {
+		row := map[string]interface{}{}
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		table = append(table, row)
+	}
+
+	return table, nil
+}
+
+// LoadTableCSV reads a table from a CSV file, as ParseTableCSV
+func LoadTableCSV(p string) (Table, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseTableCSV(f)
+}
+
+// ParseTableJSON reads a table from a JSON array of objects; values keep their
+// JSON types
+func ParseTableJSON(b []byte) (Table, error) {
+	var table Table
+	if err := unmarshalNumbers(b, &table); err != nil {
+		return nil, fmt.Errorf("JSON table must be an array of objects: %v", err)
+	}
+
+	return table, nil
+}
+
+// LoadTableJSON reads a table from a JSON file, as ParseTableJSON
+func LoadTableJSON(p string) (Table, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTableJSON(b)
+}
@@ -0,0 +1,138 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testTemplate = &Template{
+	Method:  "POST",
+	Path:    "/words/{lang}/{word}?q={q}",
+	Headers: &http.Header{"X-Lang": {"{lang}"}},
+	Body:    map[string]interface{}{"count": "{count}", "label": "{lang}-{word}"},
+}
+
+func TestTemplateExpand(t *testing.T) {
+	requests, err := testTemplate.Expand(Table{
+		{"lang": "en", "word": "a b", "q": "x&y", "count": 3},
+		{"lang": "fr", "word": "c", "q": "", "count": "many"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+
+	r := requests[0]
+	if r.Name != "count=3,lang=en,q=x&y,word=a b" {
+		t.Errorf("unexpected name %q", r.Name)
+	}
+	if r.Path != "/words/en/a%20b?q=x%26y" {
+		t.Errorf("unexpected path %q", r.Path)
+	}
+	if v := r.Headers.Get("X-Lang"); v != "en" {
+		t.Errorf("unexpected header %q", v)
+	}
+	body, _ := json.Marshal(r.Body)
+	if string(body) != `{"count":3,"label":"en-a b"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	body, _ = json.Marshal(requests[1].Body)
+	if string(body) != `{"count":"many","label":"fr-c"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	// the template itself is left alone
+	if testTemplate.Headers.Get("X-Lang") != "{lang}" || testTemplate.Body.(map[string]interface{})["count"] != "{count}" {
+		t.Error("expected the template to be unchanged")
+	}
+
+	if _, err := testTemplate.Expand(Table{{"lang": "en"}}); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "row 1: no value for word, q") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	text := &Template{Method: "POST", Path: "/", Body: "hello {name}"}
+	requests, err = text.Expand(Table{{"name": "world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests[0].Body != "hello world" {
+		t.Errorf("unexpected body %v", requests[0].Body)
+	}
+}
+
+func TestTables(t *testing.T) {
+	table, err := ParseTableCSV(strings.NewReader("lang,word\nen,hello\nfr,\"bon, jour\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 2 || table[1]["word"] != "bon, jour" {
+		t.Errorf("unexpected table %v", table)
+	}
+
+	table, err = ParseTableJSON([]byte(`[{"id":12345678901234567890,"ok":true}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowName(table[0]) != "id=12345678901234567890,ok=true" {
+		t.Errorf("unexpected row %v", table[0])
+	}
+
+	if _, err := ParseTableJSON([]byte(`{"id":1}`)); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+	if _, err := ParseTableCSV(strings.NewReader("")); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+
+	dir, err := ioutil.TempDir("", "congruent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	csvPath, jsonPath := filepath.Join(dir, "t.csv"), filepath.Join(dir, "t.json")
+	ioutil.WriteFile(csvPath, []byte("a\n1\n2\n"), 0644)
+	ioutil.WriteFile(jsonPath, []byte(`[{"a":1},{"a":2}]`), 0644)
+
+	if table, err := LoadTableCSV(csvPath); err != nil || len(table) != 2 {
+		t.Errorf("unexpected table %v, %v", table, err)
+	}
+	if table, err := LoadTableJSON(jsonPath); err != nil || len(table) != 2 {
+		t.Errorf("unexpected table %v, %v", table, err)
+	}
+}
+
+func TestTemplateCheck(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+	servers := Servers{NewServer(ts.URL, nil), NewServer(ts.URL, nil)}
+
+	tmpl := &Template{Method: "GET", Path: "/items/{id}"}
+	requests, err := tmpl.Expand(Table{{"id": 1}, {"id": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range []string{"id=1", "id=2"} {
+		if n := requests[i].testName(); n != name {
+			t.Errorf("expected subtest name %q, got %q", name, n)
+		}
+	}
+	if !requests.Check(t, servers, Responses.BodySame) {
+		t.Error("expected the expanded requests to pass")
+	}
+}
@@ -0,0 +1,123 @@
+package congruent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Middleware rewrites a request before it is sent to a Server, so that one
+// Request can be made against servers whose APIs differ in small ways
+type Middleware func(req *http.Request) error
+
+// RewritePath replaces the prefix `from` of the request's path with `to`, like
+// `/api/v1/` with `/v1/`; paths without the prefix are left alone. The path
+// includes any path in the Server's BaseURI, and is matched in its escaped
+// form.
+func RewritePath(from, to string) Middleware {
+	return func(req *http.Request) error {
+		p := req.URL.EscapedPath()
+		if !strings.HasPrefix(p, from) {
+			return nil
+		}
+
+		rewritten := to + p[len(from):]
+		unescaped, err := url.PathUnescape(rewritten)
+		if err != nil {
+			return err
+		}
+		req.URL.Path, req.URL.RawPath = unescaped, rewritten
+
+		return nil
+	}
+}
+
+// RenameHeader moves the values of header `from` to `to`, replacing any that
+// `to` had, like `X-Api-Key` to `Authorization`
+func RenameHeader(from, to string) Middleware {
+	return func(req *http.Request) error {
+		values := req.Header.Values(from)
+		if len(values) == 0 {
+			return nil
+		}
+
+		req.Header.Del(from)
+		req.Header.Del(to)
+		for _, v := range values {
+			req.Header.Add(to, v)
+		}
+
+		return nil
+	}
+}
+
+// RenameQuery moves the values of query parameter `from` to `to`, replacing
+// any that `to` had; the query is re-encoded, with its parameters sorted
+func RenameQuery(from, to string) Middleware {
+	return func(req *http.Request) error {
+		query := req.URL.Query()
+		values, ok := query[from]
+		if !ok {
+			return nil
+		}
+
+		delete(query, from)
+		query[to] = values
+		req.URL.RawQuery = query.Encode()
+
+		return nil
+	}
+}
+
+// TransformBody replaces the request's body with the result of calling f on it
+func TransformBody(f func(body []byte) ([]byte, error)) Middleware {
+	return func(req *http.Request) error {
+		body, err := requestBody(req)
+		if err != nil {
+			return err
+		}
+
+		transformed, err := f(body)
+		if err != nil {
+			return err
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(transformed))
+		req.ContentLength = int64(len(transformed))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(transformed)), nil
+		}
+
+		return nil
+	}
+}
+
+// rewrite applies the Server's middleware to a request, in order
+func (s *Server) rewrite(req *http.Request) error {
+	for _, m := range s.Middleware {
+		if err := m(req); err != nil {
+			return fmt.Errorf("(%s)%s: %v", req.Method, req.URL, err)
+		}
+	}
+
+	return nil
+}
+
+// requestBody reads the body of a request without consuming it
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody == nil {
+		return nil, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
@@ -0,0 +1,107 @@
+package congruent
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	// the old API is under /api/v1/, keyed with X-Api-Key, and searched with q;
+	// the new one is under /v1/, keyed with Authorization, and searched with query
+	oldAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/") || r.Header.Get("X-Api-Key") != "k" {
+			w.WriteHeader(404)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", strings.TrimPrefix(r.URL.Path, "/api/v1/"), r.URL.Query().Get("q"), body)
+	}))
+	defer oldAPI.Close()
+	newAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") || r.Header.Get("Authorization") != "k" || r.Header.Get("X-Api-Key") != "" {
+			w.WriteHeader(404)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", strings.TrimPrefix(r.URL.Path, "/v1/"), r.URL.Query().Get("query"), bytes.ToLower(body))
+	}))
+	defer newAPI.Close()
+
+	servers := Servers{
+		NewServer(oldAPI.URL, nil),
+		&Server{
+			BaseURI: newAPI.URL,
+			Middleware: []Middleware{
+				RewritePath("/api/v1/", "/v1/"),
+				RenameHeader("X-Api-Key", "Authorization"),
+				RenameQuery("q", "query"),
+				TransformBody(func(b []byte) ([]byte, error) {
+					return bytes.ToUpper(b), nil
+				}),
+			},
+		},
+	}
+
+	req := NewRequest("POST", "/api/v1/words%2Fall?q=hello", &http.Header{"X-Api-Key": {"k"}}, "body")
+	responses, err := servers.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.StatusSame(); err != nil {
+		t.Error(err)
+	}
+	if err := responses.BodySame(); err != nil {
+		t.Error(err)
+	}
+	if s := string(responses[1].Body); s != "words/all hello body" {
+		t.Errorf("unexpected body %q", s)
+	}
+	if p := responses[1].Request.URL.RequestURI(); p != "/v1/words%2Fall?query=hello" {
+		t.Errorf("unexpected request URI %s", p)
+	}
+
+	// reproductions show the request as rewritten
+	cmd, err := req.Curl(servers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{newAPI.URL + "/v1/words%2Fall?query=hello", "-H 'Authorization: k'", "--data-raw BODY"} {
+		if !strings.Contains(cmd, s) {
+			t.Errorf("expected %q in %s", s, cmd)
+		}
+	}
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	server := &Server{
+		BaseURI: "http://localhost",
+		Middleware: []Middleware{
+			TransformBody(func(b []byte) ([]byte, error) {
+				return nil, fmt.Errorf("bad body")
+			}),
+		},
+	}
+
+	_, err := NewRequest("POST", "/words", nil, "x").Do(server)
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	if err.Error() != "(POST)http://localhost/words: bad body" {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	// rules which don't match leave the request alone
+	server.Middleware = []Middleware{RewritePath("/other/", "/"), RenameHeader("X-Missing", "X-New"), RenameQuery("missing", "new")}
+	req, err := NewRequest("GET", "/words?a=1&b=2", &http.Header{"X-Test": {"1"}}, nil).newHTTPRequest(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "http://localhost/words?a=1&b=2" || len(req.Header) != 1 {
+		t.Errorf("unexpected request %s %v", req.URL, req.Header)
+	}
+}
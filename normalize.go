@@ -0,0 +1,114 @@
+package congruent
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// BaseURIPlaceholder replaces a server's BaseURI, or any of its Aliases, in
+// bodies and headers rewritten by NormalizeURLs.
+const BaseURIPlaceholder = "{base}"
+
+// urlReplacements lists what to swap for BaseURIPlaceholder in a response from
+// this server, longest first so that a BaseURI with a path wins over an alias
+// which is only a host
+func (s *Server) urlReplacements() []string {
+	seen := map[string]bool{}
+	var from []string
+
+	for _, u := range append([]string{s.BaseURI}, s.Aliases...) {
+		u = strings.TrimRight(u, "/")
+		if u == "" {
+			continue
+		}
+
+		// JSON encoders may escape forward slashes
+		for _, v := range []string{u, strings.Replace(u, "/", `\/`, -1)} {
+			if !seen[v] {
+				seen[v] = true
+				from = append(from, v)
+			}
+		}
+	}
+
+	sort.SliceStable(from, func(i, j int) bool { return len(from[i]) > len(from[j]) })
+
+	return from
+}
+
+// replaceURLs swaps each of `from` for BaseURIPlaceholder where it ends at a
+// URL boundary, so that `http://localhost:3000` isn't taken for the start of
+// `http://localhost:30001`
+func replaceURLs(s string, from []string) string {
+	for _, f := range from {
+		var b strings.Builder
+		for {
+			i := strings.Index(s, f)
+			if i < 0 {
+				break
+			}
+			end := i + len(f)
+			if end == len(s) || urlBoundary(s[end]) {
+				b.WriteString(s[:i])
+				b.WriteString(BaseURIPlaceholder)
+			} else {
+				b.WriteString(s[:end])
+			}
+			s = s[end:]
+		}
+		b.WriteString(s)
+		s = b.String()
+	}
+
+	return s
+}
+
+// urlBoundary reports whether a URL can end before c; a backslash starts an
+// escaped slash in JSON
+func urlBoundary(c byte) bool {
+	switch c {
+	case '/', '?', '#', '"', '\'', '>', '\\', ' ', '\t', '\r', '\n':
+		return true
+	}
+
+	return false
+}
+
+// NormalizeURLs returns a copy of the responses, with each server's BaseURI and
+// Aliases replaced by BaseURIPlaceholder in every body and header value. Call it
+// before any assertions, so that links which embed the server's own address,
+// like `http://localhost:3000/items/1` and `https://example.com/items/1`,
+// compare the same. Trailing slashes are ignored when matching, so both of
+// those become `{base}/items/1`.
+func (r Responses) NormalizeURLs() Responses {
+	normalized := make(Responses, len(r))
+
+	for i, resp := range r {
+		if resp == nil || resp.Server == nil {
+			normalized[i] = resp
+			continue
+		}
+
+		from := resp.Server.urlReplacements()
+		nr := *resp
+
+		if resp.Body != nil {
+			nr.Body = []byte(replaceURLs(string(resp.Body), from))
+		}
+
+		if resp.Headers != nil {
+			headers := http.Header{}
+			for k, va := range *resp.Headers {
+				for _, v := range va {
+					headers.Add(k, replaceURLs(v, from))
+				}
+			}
+			nr.Headers = &headers
+		}
+
+		normalized[i] = &nr
+	}
+
+	return normalized
+}
@@ -0,0 +1,97 @@
+package congruent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLReplacements(t *testing.T) {
+	s := &Server{
+		BaseURI: "http://localhost:3000/api/v1/",
+		Aliases: []string{"https://example.com", ""},
+	}
+
+	expected := []string{
+		`http:\/\/localhost:3000\/api\/v1`,
+		"http://localhost:3000/api/v1",
+		`https:\/\/example.com`,
+		"https://example.com",
+	}
+
+	from := s.urlReplacements()
+	if lf, le := len(from), len(expected); lf != le {
+		t.Fatalf("expected %v, got %v", expected, from)
+	}
+	for i := range expected {
+		if from[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], from[i])
+		}
+	}
+}
+
+func TestNormalizeURLs(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		w.Header().Set("Link", fmt.Sprintf(`<%s/api/items?page=2>; rel="next"`, base))
+		fmt.Fprintf(w, `{"self":"%s/api/items/1","escaped":"%s","home":"https://www.example.com/"}`,
+			base, "http:\\/\\/"+r.Host+"\\/api\\/items\\/1")
+	}
+
+	ts0 := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts1.Close()
+
+	servers := Servers{
+		&Server{BaseURI: ts0.URL + "/api/", Aliases: []string{"https://www.example.com"}},
+		&Server{BaseURI: ts1.URL + "/api/"},
+	}
+
+	responses, err := servers.Request(NewRequest("GET", "items", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.BodySame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+
+	normalized := responses.NormalizeURLs()
+	if err := normalized.HeaderEqual("Link", `<{base}/items?page=2>; rel="next"`); err != nil {
+		t.Error(err)
+	}
+	if err := normalized.BodyContentSame(IgnorePaths("$.home")); err != nil {
+		t.Error(err)
+	}
+	if err := normalized.BodySame(); err == nil {
+		t.Error("Expected only the server with the alias to rewrite it")
+	}
+
+	// the originals are left alone
+	if err := responses.HeaderEqual("Link", `<{base}/items?page=2>; rel="next"`); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestReplaceURLsAtBoundaries(t *testing.T) {
+	from := []string{"http://localhost:3000"}
+	cases := map[string]string{
+		"http://localhost:3000":                         "{base}",
+		"http://localhost:3000/x":                       "{base}/x",
+		"http://localhost:3000?q=1":                     "{base}?q=1",
+		"http://localhost:3000#top":                     "{base}#top",
+		`"http://localhost:3000"`:                       `"{base}"`,
+		"<http://localhost:3000>; rel=up":               "<{base}>; rel=up",
+		"see http://localhost:3000 now":                 "see {base} now",
+		"http://localhost:30001/x":                      "http://localhost:30001/x",
+		"http://localhost:3000.example/x":               "http://localhost:3000.example/x",
+		"http://localhost:30001 http://localhost:3000/": "http://localhost:30001 {base}/",
+	}
+
+	for in, expected := range cases {
+		if out := replaceURLs(in, from); out != expected {
+			t.Errorf("%s: expected %s, got %s", in, expected, out)
+		}
+	}
+}
@@ -0,0 +1,689 @@
+package congruent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// openAPIMethods are the operation keys of an OpenAPI path item, in the order
+// operations are generated
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// OpenAPI is an OpenAPI 3 document, from which a suite of Requests can be
+// generated and against which Responses can be validated. Only JSON documents
+// are supported; convert YAML specs before loading them.
+type OpenAPI struct {
+	doc        map[string]interface{}
+	schema     *Schema
+	operations []*Operation
+
+	mu        sync.Mutex
+	exercised map[*Operation]map[*Server]bool
+}
+
+// Operation is a single method and path from an OpenAPI document. ID is its
+// `operationId`, or the method and path when that isn't set.
+type Operation struct {
+	ID     string
+	Method string
+	Path   string
+
+	op       map[string]interface{}
+	params   []map[string]interface{}
+	segments []string
+}
+
+// LoadOpenAPI reads an OpenAPI 3 document from a JSON file
+func LoadOpenAPI(p string) (*OpenAPI, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseOpenAPI(b)
+}
+
+// ParseOpenAPI reads an OpenAPI 3 document from its JSON encoding
+func ParseOpenAPI(b []byte) (*OpenAPI, error) {
+	var doc map[string]interface{}
+	if err := unmarshalNumbers(b, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", v)
+	}
+
+	// the whole document is a schema resource, so that `#/components/...`
+	// references resolve from any schema within it
+	schema, err := newSchema(doc, defaultSchemaBase)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &OpenAPI{doc: doc, schema: schema, exercised: map[*Operation]map[*Server]bool{}}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	for _, p := range sortedKeys(paths) {
+		item, _ := o.deref(paths[p]).(map[string]interface{})
+		shared, _ := item["parameters"].([]interface{})
+
+		for _, m := range openAPIMethods {
+			op, ok := item[m].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			operation := &Operation{
+				Method:   strings.ToUpper(m),
+				Path:     p,
+				op:       op,
+				segments: strings.Split(strings.Trim(p, "/"), "/"),
+			}
+			operation.ID, _ = op["operationId"].(string)
+			if operation.ID == "" {
+				operation.ID = operation.Method + " " + p
+			}
+
+			own, _ := op["parameters"].([]interface{})
+			operation.params = o.mergeParams(shared, own)
+
+			o.operations = append(o.operations, operation)
+		}
+	}
+
+	return o, nil
+}
+
+// deref follows `$ref`s within the document until it reaches a real value
+func (o *OpenAPI) deref(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return v
+		}
+		target, _, err := o.schema.resolve(o.schema.base, ref)
+		if err != nil {
+			return v
+		}
+		v = target
+	}
+
+	return v
+}
+
+// mergeParams combines path-level and operation-level parameters; the latter
+// override the former when they share a name and location
+func (o *OpenAPI) mergeParams(shared, own []interface{}) []map[string]interface{} {
+	var params []map[string]interface{}
+	index := map[string]int{}
+
+	for _, list := range [][]interface{}{shared, own} {
+		for _, p := range list {
+			param, ok := o.deref(p).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("%v:%v", param["in"], param["name"])
+			if i, ok := index[key]; ok {
+				params[i] = param
+				continue
+			}
+			index[key] = len(params)
+			params = append(params, param)
+		}
+	}
+
+	return params
+}
+
+// Operations lists every operation in the document, sorted by path
+func (o *OpenAPI) Operations() []*Operation {
+	return o.operations
+}
+
+// Requests generates a Request for every operation in the document. Parameter
+// and body values come from the document's examples where there are any, and
+// are otherwise derived from their schemas. Optional query and header
+// parameters are only sent when they have an example.
+func (o *OpenAPI) Requests() (Requests, error) {
+	var requests Requests
+	for _, op := range o.operations {
+		r, err := o.request(op)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, nil
+}
+
+func (o *OpenAPI) request(op *Operation) (*Request, error) {
+	p := op.Path
+	query := url.Values{}
+	headers := http.Header{}
+
+	for _, param := range op.params {
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		required, _ := param["required"].(bool)
+
+		value, hasExample := o.example(param)
+		if !hasExample {
+			if in != "path" && !required {
+				continue
+			}
+			value = o.sample(param["schema"], 0)
+		}
+
+		s := paramString(value)
+		switch in {
+		case "path":
+			p = strings.Replace(p, "{"+name+"}", url.PathEscape(s), -1)
+		case "query":
+			query.Add(name, s)
+		case "header":
+			headers.Add(name, s)
+		}
+	}
+
+	if len(query) > 0 {
+		p += "?" + query.Encode()
+	}
+
+	var body interface{}
+	if rb, ok := o.deref(op.op["requestBody"]).(map[string]interface{}); ok {
+		content, _ := rb["content"].(map[string]interface{})
+		if mt, isJSON, ok := requestMediaType(content); ok {
+			media, _ := content[mt].(map[string]interface{})
+			value, ok := o.example(media)
+			if !ok {
+				value = o.sample(media["schema"], 0)
+			}
+
+			if isJSON {
+				body = value
+			} else {
+				body = paramString(value)
+			}
+			headers.Set("Content-Type", mt)
+		}
+	}
+
+	r := NewRequest(op.Method, p, &headers, body)
+	if body == nil {
+		r.Body = ""
+	}
+
+	return r, nil
+}
+
+// requestMediaType picks the media type a request body is sent as: the first
+// JSON one, or else the first of all, and reports whether it's JSON
+func requestMediaType(content map[string]interface{}) (string, bool, bool) {
+	keys := sortedKeys(content)
+	for _, mt := range keys {
+		if ct, _, _ := mime.ParseMediaType(mt); isJSONMediaType(ct) {
+			return mt, true, true
+		}
+	}
+	if len(keys) == 0 {
+		return "", false, false
+	}
+
+	return keys[0], false, true
+}
+
+// example returns the example for a parameter or media type, from `example`,
+// the first of `examples`, or its schema's `example`
+func (o *OpenAPI) example(obj map[string]interface{}) (interface{}, bool) {
+	if v, ok := obj["example"]; ok {
+		return v, true
+	}
+
+	if examples, ok := obj["examples"].(map[string]interface{}); ok {
+		for _, k := range sortedKeys(examples) {
+			if ex, ok := o.deref(examples[k]).(map[string]interface{}); ok {
+				if v, ok := ex["value"]; ok {
+					return v, true
+				}
+			}
+		}
+	}
+
+	if schema, ok := o.deref(obj["schema"]).(map[string]interface{}); ok {
+		if v, ok := schema["example"]; ok {
+			return v, true
+		}
+		if ex, ok := schema["examples"].([]interface{}); ok && len(ex) > 0 {
+			return ex[0], true
+		}
+	}
+
+	return nil, false
+}
+
+// sample derives a plausible value from a schema
+func (o *OpenAPI) sample(s interface{}, depth int) interface{} {
+	schema, ok := o.deref(s).(map[string]interface{})
+	if !ok || depth > 8 {
+		return nil
+	}
+
+	for _, k := range []string{"example", "default", "const"} {
+		if v, ok := schema[k]; ok {
+			return v
+		}
+	}
+	if ex, ok := schema["examples"].([]interface{}); ok && len(ex) > 0 {
+		return ex[0]
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, sub := range all {
+			if obj, ok := o.sample(sub, depth+1).(map[string]interface{}); ok {
+				for k, v := range obj {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+	for _, k := range []string{"oneOf", "anyOf"} {
+		if subs, ok := schema[k].([]interface{}); ok && len(subs) > 0 {
+			return o.sample(subs[0], depth+1)
+		}
+	}
+
+	typ := schema["type"]
+	if types, ok := typ.([]interface{}); ok && len(types) > 0 {
+		typ = types[0]
+	}
+	if typ == nil {
+		if _, ok := schema["properties"]; ok {
+			typ = "object"
+		}
+	}
+
+	switch typ {
+	case "object":
+		obj := map[string]interface{}{}
+		props, _ := schema["properties"].(map[string]interface{})
+		for _, k := range sortedKeys(props) {
+			if p, ok := o.deref(props[k]).(map[string]interface{}); ok && p["readOnly"] == true {
+				continue
+			}
+			obj[k] = o.sample(props[k], depth+1)
+		}
+		return obj
+	case "array":
+		return []interface{}{o.sample(schema["items"], depth+1)}
+	case "integer", "number":
+		return sampleNumber(schema, typ == "integer")
+	case "boolean":
+		return true
+	case "string":
+		switch schema["format"] {
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "date":
+			return "2006-01-02"
+		case "uuid":
+			return "00000000-0000-4000-8000-000000000000"
+		case "email":
+			return "user@example.com"
+		case "uri":
+			return "https://example.com/"
+		}
+		if min, ok := jsonInt(schema["minLength"]); ok && min > 6 {
+			return strings.Repeat("s", min)
+		}
+		return "string"
+	}
+
+	return nil
+}
+
+// sampleNumber picks a number within a schema's bounds: the lowest allowed if
+// there is a minimum, otherwise 1 if that's allowed, otherwise the highest.
+// An exclusive bound is either a number, or `true` alongside the bound it
+// makes exclusive, as OpenAPI 3.0 has it.
+func sampleNumber(schema map[string]interface{}, integer bool) interface{} {
+	min, hasMin := jsonRat(schema["minimum"])
+	minExclusive := hasMin && schema["exclusiveMinimum"] == true
+	if m, ok := jsonRat(schema["exclusiveMinimum"]); ok && (!hasMin || m.Cmp(min) >= 0) {
+		min, hasMin, minExclusive = m, true, true
+	}
+	max, hasMax := jsonRat(schema["maximum"])
+	maxExclusive := hasMax && schema["exclusiveMaximum"] == true
+	if m, ok := jsonRat(schema["exclusiveMaximum"]); ok && (!hasMax || m.Cmp(max) <= 0) {
+		max, hasMax, maxExclusive = m, true, true
+	}
+
+	one := big.NewRat(1, 1)
+	if integer {
+		switch {
+		case hasMin:
+			n := ceilRat(min)
+			if minExclusive && min.IsInt() {
+				n.Add(n, big.NewInt(1))
+			}
+			return n.Int64()
+		case hasMax:
+			n := new(big.Int).Neg(ceilRat(new(big.Rat).Neg(max)))
+			if maxExclusive && max.IsInt() {
+				n.Sub(n, big.NewInt(1))
+			}
+			if n.Cmp(big.NewInt(1)) < 0 {
+				return n.Int64()
+			}
+		}
+		return 1
+	}
+
+	v := one
+	switch {
+	case hasMin && !minExclusive:
+		v = min
+	case hasMin && hasMax:
+		v = new(big.Rat).Add(min, max)
+		v.Quo(v, big.NewRat(2, 1))
+	case hasMin:
+		v = new(big.Rat).Add(min, one)
+	case hasMax && (max.Cmp(one) < 0 || maxExclusive && max.Cmp(one) == 0):
+		v = max
+		if maxExclusive {
+			v = new(big.Rat).Sub(max, one)
+		}
+	}
+	f, _ := v.Float64()
+
+	return f
+}
+
+// ceilRat is the smallest integer not less than r
+func ceilRat(r *big.Rat) *big.Int {
+	// Div rounds towards negative infinity for a positive divisor, as a
+	// rational's denominator always is
+	n := new(big.Int).Div(r.Num(), r.Denom())
+	if !r.IsInt() {
+		n.Add(n, big.NewInt(1))
+	}
+
+	return n
+}
+
+func paramString(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return n
+	case []interface{}:
+		var parts []string
+		for _, item := range n {
+			parts = append(parts, paramString(item))
+		}
+		return strings.Join(parts, ",")
+	}
+
+	return fmt.Sprint(v)
+}
+
+// match finds the operation for a request, stripping the server's own base
+// path before matching path templates
+func (o *OpenAPI) match(resp *Response) *Operation {
+	p := resp.Request.URL.Path
+	if resp.Server != nil {
+		if bu, err := url.Parse(resp.Server.BaseURI); err == nil {
+			p = strings.TrimPrefix(p, strings.TrimRight(bu.Path, "/"))
+		}
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+
+	var best *Operation
+	bestLiteral := -1
+	for _, op := range o.operations {
+		if op.Method != resp.Request.Method || len(op.segments) != len(segments) {
+			continue
+		}
+
+		literal, ok := 0, true
+		for i, seg := range op.segments {
+			if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+				continue
+			}
+			if seg != segments[i] {
+				ok = false
+				break
+			}
+			literal++
+		}
+
+		// prefer `/items/mine` over `/items/{id}`
+		if ok && literal > bestLiteral {
+			best, bestLiteral = op, literal
+		}
+	}
+
+	return best
+}
+
+// response finds the declared response for a status code, trying the exact
+// code, then its range, as `2XX`, then `default`
+func (o *OpenAPI) response(op *Operation, status int) (map[string]interface{}, bool) {
+	responses, _ := op.op["responses"].(map[string]interface{})
+
+	code := strconv.Itoa(status)
+	for _, k := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if r, ok := o.deref(responses[k]).(map[string]interface{}); ok {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// Validate checks every response against the document: that a matching
+// operation exists, that its status code is declared, and that its body
+// conforms to the declared schema for its content type, which must itself be
+// declared. JSON bodies are decoded first; any other body is validated as a
+// string. Every violation is reported, per server. Operations that were
+// matched are recorded for Coverage.
+func (o *OpenAPI) Validate(r Responses) error {
+	var failures []string
+
+	for _, resp := range r {
+		prefix := fmt.Sprintf("(%s)%s", resp.Request.Method, resp.Request.URL)
+
+		op := o.match(resp)
+		if op == nil {
+			failures = append(failures, prefix+": No operation matches this request")
+			continue
+		}
+
+		o.mu.Lock()
+		if o.exercised[op] == nil {
+			o.exercised[op] = map[*Server]bool{}
+		}
+		o.exercised[op][resp.Server] = true
+		o.mu.Unlock()
+
+		declared, ok := o.response(op, resp.StatusCode)
+		if !ok {
+			failures = append(failures, fmt.Sprintf(
+				"%s: Status %d is not declared for %s", prefix, resp.StatusCode, op.ID))
+			continue
+		}
+
+		content, _ := declared["content"].(map[string]interface{})
+		if len(content) == 0 {
+			continue
+		}
+
+		ct := ""
+		if resp.Headers != nil {
+			ct, _, _ = mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+		}
+		media, ok := declaredMedia(content, ct)
+		if !ok {
+			failures = append(failures, fmt.Sprintf(
+				"%s: Content-Type %q is not declared for %s %d", prefix, ct, op.ID, resp.StatusCode))
+			continue
+		}
+
+		schema, ok := media["schema"]
+		if !ok {
+			continue
+		}
+
+		// anything other than JSON is validated as a string
+		var body interface{} = string(resp.Body)
+		if isJSONMediaType(ct) {
+			if err := unmarshalNumbers(resp.Body, &body); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: Body was not JSON: %v", prefix, err))
+				continue
+			}
+		}
+
+		errs, _ := o.schema.validate(map[string]bool{}, schema, o.schema.base, body, nil, "#")
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].InstancePath < errs[j].InstancePath })
+		for _, e := range errs {
+			failures = append(failures, fmt.Sprintf("%s: %s %d: %v", prefix, op.ID, resp.StatusCode, e))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("OpenAPI violations:\n%s", strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+// declaredMedia finds the declared media type for a content type, trying it
+// exactly, then its range, as `text/*`, then `*/*`
+func declaredMedia(content map[string]interface{}, ct string) (map[string]interface{}, bool) {
+	if ct == "" {
+		return nil, false
+	}
+
+	candidates := []string{ct}
+	if i := strings.Index(ct, "/"); i > 0 {
+		candidates = append(candidates, ct[:i]+"/*")
+	}
+	candidates = append(candidates, "*/*")
+
+	for _, k := range candidates {
+		if media, ok := content[k].(map[string]interface{}); ok {
+			return media, true
+		}
+	}
+
+	return nil, false
+}
+
+// isJSONMediaType reports whether a media type, without parameters, is JSON,
+// like `application/json` or `application/problem+json`
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// CoverageReport lists, for every operation in a document, which servers had
+// a response to it validated
+type CoverageReport struct {
+	Servers    Servers
+	Operations []OperationCoverage
+}
+
+// OperationCoverage is the coverage of a single operation
+type OperationCoverage struct {
+	Operation *Operation
+	Servers   Servers
+}
+
+// Complete reports whether the operation was exercised against every server
+func (c OperationCoverage) Complete(s Servers) bool {
+	for _, server := range s {
+		found := false
+		for _, e := range c.Servers {
+			if e == server {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Coverage reports which operations have been exercised, through Validate,
+// against each of the given servers
+func (o *OpenAPI) Coverage(s Servers) CoverageReport {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	report := CoverageReport{Servers: s}
+	for _, op := range o.operations {
+		oc := OperationCoverage{Operation: op}
+		for _, server := range s {
+			if o.exercised[op][server] {
+				oc.Servers = append(oc.Servers, server)
+			}
+		}
+		report.Operations = append(report.Operations, oc)
+	}
+
+	return report
+}
+
+// Missing lists the IDs of operations that weren't exercised against every
+// server
+func (c CoverageReport) Missing() []string {
+	var missing []string
+	for _, oc := range c.Operations {
+		if !oc.Complete(c.Servers) {
+			missing = append(missing, oc.Operation.ID)
+		}
+	}
+
+	return missing
+}
+
+// String renders the report as one line per operation, with the number of
+// servers it was exercised against
+func (c CoverageReport) String() string {
+	var b strings.Builder
+
+	complete := 0
+	for _, oc := range c.Operations {
+		mark := " "
+		if oc.Complete(c.Servers) {
+			mark = "x"
+			complete++
+		}
+		fmt.Fprintf(&b, "[%s] %s (%s %s): %d/%d servers\n",
+			mark, oc.Operation.ID, oc.Operation.Method, oc.Operation.Path, len(oc.Servers), len(c.Servers))
+	}
+	fmt.Fprintf(&b, "%d/%d operations exercised against every server\n", complete, len(c.Operations))
+
+	return b.String()
+}
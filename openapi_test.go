@@ -0,0 +1,325 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOpenAPI = `{
+  "openapi": "3.0.3",
+  "info": {"title": "words", "version": "1"},
+  "paths": {
+    "/words/{id}": {
+      "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer", "example": 7}}],
+      "get": {
+        "operationId": "getWord",
+        "parameters": [
+          {"name": "lang", "in": "query", "schema": {"type": "string"}, "example": "en"},
+          {"name": "verbose", "in": "query", "schema": {"type": "boolean"}}
+        ],
+        "responses": {
+          "200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Word"}}}},
+          "4XX": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+        }
+      }
+    },
+    "/words/random": {
+      "get": {"responses": {"200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Word"}}}}}}
+    },
+    "/words": {
+      "post": {
+        "operationId": "createWord",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Word"}}}},
+        "responses": {"201": {"description": "created"}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Word": {
+        "type": "object",
+        "required": ["word"],
+        "properties": {
+          "id": {"type": "integer", "readOnly": true},
+          "word": {"type": "string", "pattern": "^[a-z]+$", "example": "alpha"},
+          "note": {"type": "string", "nullable": true}
+        }
+      },
+      "Error": {"type": "object", "required": ["error"], "properties": {"error": {"type": "string"}}}
+    }
+  }
+}`
+
+func TestOpenAPIRequests(t *testing.T) {
+	o, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := o.Operations()
+	ids := []string{}
+	for _, op := range ops {
+		ids = append(ids, op.ID)
+	}
+	if strings.Join(ids, ",") != "createWord,GET /words/random,getWord" {
+		t.Errorf("unexpected operations %v", ids)
+	}
+
+	requests, err := o.Requests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+
+	post := requests[0]
+	if post.Method != "POST" || post.Path != "/words" || post.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request %+v", post)
+	}
+	body, _ := json.Marshal(post.Body)
+	if string(body) != `{"note":"string","word":"alpha"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	if get := requests[2]; get.Path != "/words/7?lang=en" {
+		t.Errorf("unexpected path %s", get.Path)
+	}
+}
+
+func TestOpenAPIRequestMediaTypes(t *testing.T) {
+	o, err := ParseOpenAPI([]byte(`{
+	  "openapi": "3.1.0",
+	  "info": {"title": "media", "version": "1"},
+	  "paths": {
+	    "/form": {"post": {"requestBody": {"content": {
+	      "text/plain": {"example": "hi"},
+	      "application/x-www-form-urlencoded": {"example": "a=1"}
+	    }}, "responses": {"204": {"description": "ok"}}}},
+	    "/patch": {"patch": {"requestBody": {"content": {
+	      "text/plain": {"example": "hi"},
+	      "application/merge-patch+json": {"example": {"a": 1}}
+	    }}, "responses": {"204": {"description": "ok"}}}}
+	  }
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := o.Requests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+
+	// without a JSON type, the first is used
+	if r := requests[0]; r.Headers.Get("Content-Type") != "application/x-www-form-urlencoded" || r.Body != "a=1" {
+		t.Errorf("unexpected request %s %v", r.Headers.Get("Content-Type"), r.Body)
+	}
+	body, _ := json.Marshal(requests[1].Body)
+	if r := requests[1]; r.Headers.Get("Content-Type") != "application/merge-patch+json" || string(body) != `{"a":1}` {
+		t.Errorf("unexpected request %s %s", r.Headers.Get("Content-Type"), body)
+	}
+}
+
+func TestOpenAPISampleNumbers(t *testing.T) {
+	o, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		schema   string
+		expected interface{}
+	}{
+		{`{"type":"integer"}`, 1},
+		{`{"type":"integer","minimum":-2.5}`, int64(-2)},
+		{`{"type":"integer","minimum":2.5}`, int64(3)},
+		{`{"type":"integer","minimum":4}`, int64(4)},
+		{`{"type":"integer","exclusiveMinimum":4}`, int64(5)},
+		{`{"type":"integer","minimum":4,"exclusiveMinimum":true}`, int64(5)},
+		{`{"type":"integer","maximum":-2.5}`, int64(-3)},
+		{`{"type":"integer","exclusiveMaximum":0}`, int64(-1)},
+		{`{"type":"integer","maximum":10}`, 1},
+		{`{"type":"number","minimum":-2.5}`, -2.5},
+		{`{"type":"number","exclusiveMinimum":2,"maximum":3}`, 2.5},
+		{`{"type":"number","exclusiveMinimum":2}`, 3.0},
+		{`{"type":"number","maximum":0.5}`, 0.5},
+		{`{"type":"number","exclusiveMaximum":1}`, 0.0},
+		{`{"type":"number","maximum":10}`, 1.0},
+	}
+
+	for _, c := range cases {
+		var schema interface{}
+		if err := unmarshalNumbers([]byte(c.schema), &schema); err != nil {
+			t.Fatal(err)
+		}
+		if v := o.sample(schema, 0); v != c.expected {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", c.schema, c.expected, c.expected, v, v)
+		}
+	}
+}
+
+func TestOpenAPIValidate(t *testing.T) {
+	o, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := func(bad bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.URL.Path == "/api/words/404":
+				w.WriteHeader(404)
+				fmt.Fprint(w, `{"error":"not found"}`)
+			case bad:
+				fmt.Fprint(w, `{"word":"Alpha"}`)
+			default:
+				fmt.Fprint(w, `{"id":7,"word":"alpha","note":null}`)
+			}
+		}
+	}
+
+	good := httptest.NewServer(handler(false))
+	defer good.Close()
+	bad := httptest.NewServer(handler(true))
+	defer bad.Close()
+
+	servers := Servers{
+		&Server{BaseURI: good.URL + "/api/"},
+		&Server{BaseURI: bad.URL + "/api/"},
+	}
+
+	for _, p := range []string{"words/7", "words/404"} {
+		responses, err := servers.Request(NewRequest("GET", p, nil, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = o.Validate(responses)
+		if p == "words/404" {
+			if err != nil {
+				t.Error(err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatal("Expected error, but got none!")
+		}
+		msg := err.Error()
+		if strings.Contains(msg, good.URL) || !strings.Contains(msg, "getWord 200: $.word") {
+			t.Errorf("Did not get expected error string, got: %v", msg)
+		}
+	}
+
+	responses, err := servers.Request(NewRequest("DELETE", "words/7", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Validate(responses); err == nil || !strings.Contains(err.Error(), "No operation") {
+		t.Errorf("expected no operation to match, got %v", err)
+	}
+
+	report := o.Coverage(servers)
+	if missing := report.Missing(); strings.Join(missing, ",") != "createWord,GET /words/random" {
+		t.Errorf("unexpected missing operations %v", missing)
+	}
+	if !strings.Contains(report.String(), "[x] getWord (GET /words/{id}): 2/2 servers") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestOpenAPIMediaTypes(t *testing.T) {
+	o, err := ParseOpenAPI([]byte(`{
+	  "openapi": "3.1.0",
+	  "info": {"title": "text", "version": "1"},
+	  "paths": {"/text": {"get": {"responses": {"200": {"content": {
+	    "text/plain": {"schema": {"type": "string", "maxLength": 5}},
+	    "application/problem+json": {"schema": {"type": "object", "required": ["title"]}}
+	  }}}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", q.Get("type"))
+		fmt.Fprint(w, q.Get("body"))
+	}))
+	defer ts.Close()
+	servers := Servers{NewServer(ts.URL, nil)}
+
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"type=text/plain%3B+charset=utf-8&body=hello", ""},
+		{"type=application/problem%2Bjson&body={\"title\":\"x\"}", ""},
+		{"type=text/plain&body=too+long", "maxLength"},
+		{"type=application/problem%2Bjson&body=nope", "Body was not JSON"},
+		{"type=application/json&body={}", `Content-Type "application/json" is not declared`},
+		{"type=&body=hello", `Content-Type "" is not declared`},
+	}
+
+	for _, c := range cases {
+		responses, err := servers.Request(NewRequest("GET", "/text?"+c.query, nil, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = o.Validate(responses)
+		switch {
+		case c.expected == "" && err != nil:
+			t.Errorf("%s: %v", c.query, err)
+		case c.expected != "" && err == nil:
+			t.Errorf("%s: Expected error, but got none!", c.query)
+		case c.expected != "" && !strings.Contains(err.Error(), c.expected):
+			t.Errorf("%s: Did not get expected error string, got: %v", c.query, err)
+		}
+	}
+}
+
+func TestOpenAPIStatus(t *testing.T) {
+	o, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer ts.Close()
+
+	responses, err := Servers{&Server{BaseURI: ts.URL}}.Request(NewRequest("GET", "/words/random", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Validate(responses); err == nil || !strings.Contains(err.Error(), "Status 500 is not declared") {
+		t.Errorf("expected an undeclared status, got %v", err)
+	}
+}
+
+func TestLoadOpenAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "congruent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "openapi.json")
+	if err := ioutil.WriteFile(p, []byte(`{"swagger":"2.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOpenAPI(p); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
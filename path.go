@@ -0,0 +1,245 @@
+package congruent
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	segmentKey segmentKind = iota
+	segmentIndex
+	segmentWildcard
+)
+
+type pathSegment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// path is a compiled path expression, a small subset of JSONPath: `$` is the
+// root, `.name` or `['name']` selects an object key, `[n]` selects an array
+// index, and `.*` or `[*]` selects every key or index.
+type path []pathSegment
+
+func parsePath(s string) (path, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("invalid path %q: must start with `$`", s)
+	}
+
+	var p path
+	rest := s[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+
+			switch name {
+			case "":
+				return nil, fmt.Errorf("invalid path %q: empty key", s)
+			case "*":
+				p = append(p, pathSegment{kind: segmentWildcard})
+			default:
+				p = append(p, pathSegment{kind: segmentKey, key: name})
+			}
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unclosed `[`", s)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				p = append(p, pathSegment{kind: segmentWildcard})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p = append(p, pathSegment{kind: segmentKey, key: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("invalid path %q: bad index %q", s, inner)
+				}
+				p = append(p, pathSegment{kind: segmentIndex, index: i})
+			}
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", s, rest[0])
+		}
+	}
+
+	return p, nil
+}
+
+func parsePaths(s []string) ([]path, error) {
+	var paths []path
+	for _, ps := range s {
+		p, err := parsePath(ps)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+
+	return paths, nil
+}
+
+// matches reports whether a concrete location, made up of string keys and int
+// indexes, is selected by the path
+func (p path) matches(at []interface{}) bool {
+	if len(p) != len(at) {
+		return false
+	}
+
+	for i, seg := range p {
+		switch seg.kind {
+		case segmentKey:
+			if k, ok := at[i].(string); !ok || k != seg.key {
+				return false
+			}
+		case segmentIndex:
+			if n, ok := locationIndex(at[i]); !ok || n != seg.index {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// keyedElement is an array element that was matched by the value of one of
+// its fields, rather than by its position; it formats as `[id=42]`
+type keyedElement struct {
+	index int
+	field string
+	value interface{}
+}
+
+func (e keyedElement) String() string {
+	return fmt.Sprintf("%s=%v", e.field, e.value)
+}
+
+// locationIndex returns the array index of a location element, if it is one
+func locationIndex(elem interface{}) (int, bool) {
+	switch e := elem.(type) {
+	case int:
+		return e, true
+	case keyedElement:
+		return e.index, true
+	}
+
+	return 0, false
+}
+
+// eval returns every value selected by the path, along with its location
+func (p path) eval(v interface{}) (values []interface{}, locations [][]interface{}) {
+	var walk func(v interface{}, p path, at []interface{})
+	walk = func(v interface{}, p path, at []interface{}) {
+		if len(p) == 0 {
+			values = append(values, v)
+			locations = append(locations, at)
+			return
+		}
+
+		seg := p[0]
+		switch node := v.(type) {
+		case map[string]interface{}:
+			switch seg.kind {
+			case segmentKey:
+				if child, ok := node[seg.key]; ok {
+					walk(child, p[1:], appendLocation(at, seg.key))
+				}
+			case segmentWildcard:
+				for _, k := range sortedKeys(node) {
+					walk(node[k], p[1:], appendLocation(at, k))
+				}
+			}
+		case []interface{}:
+			switch seg.kind {
+			case segmentIndex:
+				if seg.index < len(node) {
+					walk(node[seg.index], p[1:], appendLocation(at, seg.index))
+				}
+			case segmentWildcard:
+				for i, child := range node {
+					walk(child, p[1:], appendLocation(at, i))
+				}
+			}
+		}
+	}
+	walk(v, p, nil)
+
+	return values, locations
+}
+
+func (p path) String() string {
+	var at []interface{}
+	for _, seg := range p {
+		switch seg.kind {
+		case segmentKey:
+			at = append(at, seg.key)
+		case segmentIndex:
+			at = append(at, seg.index)
+		default:
+			at = append(at, pathWildcard{})
+		}
+	}
+
+	return formatLocation(at)
+}
+
+// pathWildcard stands in for a wildcard segment when formatting a path
+type pathWildcard struct{}
+
+// appendLocation copies, so that sibling locations never share a backing array
+func appendLocation(at []interface{}, elem interface{}) []interface{} {
+	next := make([]interface{}, len(at), len(at)+1)
+	copy(next, at)
+
+	return append(next, elem)
+}
+
+// formatLocation renders a concrete location in the same syntax that paths are
+// written in
+func formatLocation(at []interface{}) string {
+	var b strings.Builder
+	b.WriteString("$")
+
+	for _, elem := range at {
+		switch e := elem.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", e)
+		case pathWildcard:
+			b.WriteString("[*]")
+		case string:
+			if e == "" || strings.ContainsAny(e, ".[]'\" ") {
+				fmt.Fprintf(&b, "['%s']", e)
+			} else {
+				b.WriteString("." + e)
+			}
+		default:
+			fmt.Fprintf(&b, "[%v]", e)
+		}
+	}
+
+	return b.String()
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,79 @@
+package congruent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	cases := []struct {
+		in     string
+		expect string
+	}{
+		{"$", "$"},
+		{"$.a.b", "$.a.b"},
+		{"$.items[0].id", "$.items[0].id"},
+		{"$.items[*].id", "$.items[*].id"},
+		{"$.*", "$[*]"},
+		{"$['odd key'][\"x\"]", "$['odd key'].x"},
+		{"$.candidate-count", "$.candidate-count"},
+	}
+
+	for _, c := range cases {
+		p, err := parsePath(c.in)
+		if err != nil {
+			t.Errorf("%s: %v", c.in, err)
+			continue
+		}
+		if s := p.String(); s != c.expect {
+			t.Errorf("expected %v, got %v", c.expect, s)
+		}
+	}
+
+	for _, bad := range []string{"", "a.b", "$.", "$[", "$[x]", "$[-1]", "$a"} {
+		if _, err := parsePath(bad); err == nil {
+			t.Errorf("%q: Expected error, but got none!", bad)
+		}
+	}
+}
+
+func TestPathMatches(t *testing.T) {
+	p, err := parsePath("$.items[*].id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.matches([]interface{}{"items", 3, "id"}) {
+		t.Error("expected path to match")
+	}
+	if p.matches([]interface{}{"items", 3, "name"}) {
+		t.Error("expected different key not to match")
+	}
+	if p.matches([]interface{}{"items", 3}) {
+		t.Error("expected shorter location not to match")
+	}
+}
+
+func TestPathEval(t *testing.T) {
+	var v interface{}
+	v = map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": 1.0},
+			map[string]interface{}{"id": 2.0},
+			map[string]interface{}{"name": "x"},
+		},
+	}
+
+	p, err := parsePath("$.items[*].id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, locations := p.eval(v)
+	if !reflect.DeepEqual(values, []interface{}{1.0, 2.0}) {
+		t.Errorf("unexpected values %v", values)
+	}
+	if l := formatLocation(locations[1]); l != "$.items[1].id" {
+		t.Errorf("unexpected location %v", l)
+	}
+}
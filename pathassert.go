@@ -0,0 +1,180 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// selectPath decodes a response's body and returns the values a path selects,
+// with their locations; it's an error for the path to select nothing
+func selectPath(resp *Response, p path) ([]interface{}, [][]interface{}, error) {
+	content, ok := decodeContent(resp.Body)
+	if !ok {
+		return nil, nil, fmt.Errorf(
+			"(%s)%s: Body was not JSON", resp.Request.Method, resp.Request.URL)
+	}
+
+	values, locations := p.eval(content)
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf(
+			"(%s)%s: Nothing found at %s", resp.Request.Method, resp.Request.URL, p)
+	}
+
+	return values, locations, nil
+}
+
+// eachPathValue calls fn for every value a path selects in every response,
+// returning the first error
+func (r Responses) eachPathValue(expr string, fn func(resp *Response, v interface{}, at []interface{}) error) error {
+	p, err := parsePath(expr)
+	if err != nil {
+		return err
+	}
+
+	for _, resp := range r {
+		values, locations, err := selectPath(resp, p)
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			if err := fn(resp, v, locations[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// PathSame verifies that the values a path selects are the same, and found in
+// the same places, in every response; returns an error for the first
+// mismatch, if not. The path is
+// written as for IgnorePaths, and the comparison can be adjusted with
+// ContentOptions as for BodyContentSame.
+func (r Responses) PathSame(expr string, opts ...ContentOption) (err error) {
+	defer r.reproducible(&err)
+
+	p, err := parsePath(expr)
+	if err != nil {
+		return err
+	}
+	c, err := newContentConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	var prev []interface{}
+	var prevLocations [][]interface{}
+	for i, resp := range r {
+		values, locations, err := selectPath(resp, p)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if lp, lv := len(prev), len(values); lp != lv {
+				return fmt.Errorf(
+					"(%s)%s: %s: expected %d values, was %d",
+					resp.Request.Method, resp.Request.URL, p, lp, lv)
+			}
+			for j := range values {
+				// a wildcard can select the same values from different places
+				if pl, l := formatLocation(prevLocations[j]), formatLocation(locations[j]); pl != l {
+					return fmt.Errorf(
+						"(%s)%s: %s: expected a value at %s, was at %s",
+						resp.Request.Method, resp.Request.URL, p, pl, l)
+				}
+				if m := compareContent(c, locations[j], prev[j], values[j]); m != nil {
+					return fmt.Errorf("(%s)%s: %s", resp.Request.Method, resp.Request.URL, m)
+				}
+			}
+		}
+		prev, prevLocations = values, locations
+	}
+
+	return nil
+}
+
+// PathEqual verifies that every value a path selects, in every response, is
+// equal to `v`; `v` is compared as though it had been encoded as JSON.
+// Returns an error for the first mismatch, if not.
+func (r Responses) PathEqual(expr string, v interface{}) (err error) {
+	defer r.reproducible(&err)
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var expected interface{}
+	if err := unmarshalNumbers(b, &expected); err != nil {
+		return err
+	}
+
+	c := &contentConfig{}
+	return r.eachPathValue(expr, func(resp *Response, v interface{}, at []interface{}) error {
+		if m := compareContent(c, at, expected, v); m != nil {
+			return fmt.Errorf("(%s)%s: %s", resp.Request.Method, resp.Request.URL, m)
+		}
+		return nil
+	})
+}
+
+// PathLen verifies that every array, object or string a path selects, in every
+// response, has length `n`; strings are measured in characters. Returns an
+// error for the first mismatch, if not.
+func (r Responses) PathLen(expr string, n int) (err error) {
+	defer r.reproducible(&err)
+
+	return r.eachPathValue(expr, func(resp *Response, v interface{}, at []interface{}) error {
+		var l int
+		switch value := v.(type) {
+		case []interface{}:
+			l = len(value)
+		case map[string]interface{}:
+			l = len(value)
+		case string:
+			l = utf8.RuneCountInString(value)
+		default:
+			return fmt.Errorf(
+				"(%s)%s: %s: %s has no length",
+				resp.Request.Method, resp.Request.URL, formatLocation(at), formatValue(v))
+		}
+
+		if l != n {
+			return fmt.Errorf(
+				"(%s)%s: %s: expected length %d, was %d",
+				resp.Request.Method, resp.Request.URL, formatLocation(at), n, l)
+		}
+		return nil
+	})
+}
+
+// PathMatches verifies that every value a path selects, in every response,
+// matches a regular expression. Strings are matched as they are; anything else
+// is matched against its JSON encoding. Returns an error for the first
+// mismatch, if not.
+func (r Responses) PathMatches(expr, pattern string) (err error) {
+	defer r.reproducible(&err)
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	return r.eachPathValue(expr, func(resp *Response, v interface{}, at []interface{}) error {
+		s, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			s = string(b)
+		}
+
+		if !re.MatchString(s) {
+			return fmt.Errorf(
+				"(%s)%s: %s: %s does not match %s",
+				resp.Request.Method, resp.Request.URL, formatLocation(at), formatValue(v), pattern)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package congruent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathAssertions(t *testing.T) {
+	responses := mockResponses(
+		`{"ok":true,"result":["alpha","beta","gamma","delta"],"candidate-count":70806}`,
+		`{"ok":true,"result":["one","two","three","four"],"candidate-count":70806.0}`,
+	)
+
+	if err := responses.PathSame("$.ok"); err != nil {
+		t.Error(err)
+	}
+	if err := responses.PathSame("$['candidate-count']"); err != nil {
+		t.Error(err)
+	}
+	if err := responses.PathLen("$.result", 4); err != nil {
+		t.Error(err)
+	}
+	if err := responses.PathEqual("$.candidate-count", 70806); err != nil {
+		t.Error(err)
+	}
+	if err := responses.PathEqual("$.ok", true); err != nil {
+		t.Error(err)
+	}
+	if err := responses.PathMatches("$.result[*]", "^[a-z]+$"); err != nil {
+		t.Error(err)
+	}
+	if err := responses.PathMatches("$.candidate-count", `^\d+`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPathAssertionsFail(t *testing.T) {
+	responses := mockResponses(
+		`{"ok":true,"result":["alpha","beta"],"n":1}`,
+		`{"ok":false,"result":["alpha","Beta","gamma"],"n":2}`,
+	)
+
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{responses.PathSame("$.ok"), "(GET)http://server1/: $.ok: expected true, was false"},
+		{responses.PathSame("$.result[*]"), "$.result[*]: expected 2 values, was 3"},
+		{responses.PathLen("$.result", 2), "(GET)http://server1/: $.result: expected length 2, was 3"},
+		{responses.PathLen("$.n", 2), "$.n: 1 has no length"},
+		{responses.PathEqual("$.n", 1), "(GET)http://server1/: $.n: expected 1, was 2"},
+		{responses.PathMatches("$.result[*]", "^[a-z]+$"), `$.result[1]: "Beta" does not match ^[a-z]+$`},
+		{responses.PathSame("$.missing"), "(GET)http://server0/: Nothing found at $.missing"},
+		{mockResponses(`{"a":1}`, `{"b":1}`).PathSame("$.*"), "(GET)http://server1/: $[*]: expected a value at $.a, was at $.b"},
+		{mockResponses("nope").PathLen("$", 1), "Body was not JSON"},
+		{responses.PathSame("ok"), "$"},
+		{responses.PathMatches("$.ok", "("), "missing closing )"},
+	}
+
+	for _, c := range cases {
+		if c.err == nil {
+			t.Errorf("%s: Expected error, but got none!", c.expected)
+			continue
+		}
+		if !strings.Contains(c.err.Error(), c.expected) {
+			t.Errorf("Did not get expected error string %q, got: %v", c.expected, c.err)
+		}
+	}
+}
@@ -0,0 +1,935 @@
+package congruent
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// field types, from google/protobuf/descriptor.proto
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+)
+
+const labelRepeated = 3
+
+var errTruncated = errors.New("protobuf: truncated message")
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, num, wt int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wt))
+}
+
+func appendLengthDelimited(b []byte, num int, v []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+
+	return append(b, v...)
+}
+
+func consumeVarint(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+
+	return 0, 0, errTruncated
+}
+
+// wireField is a single field read off the wire. Varints are held in value;
+// fixed-width and length-delimited fields keep their raw bytes in data.
+type wireField struct {
+	num   int
+	wt    int
+	value uint64
+	data  []byte
+}
+
+func parseWire(b []byte) ([]wireField, error) {
+	var fields []wireField
+
+	for len(b) > 0 {
+		tag, n, err := consumeVarint(b)
+		if err != nil {
+			return nil, err
+		}
+		b = b[n:]
+
+		f := wireField{num: int(tag >> 3), wt: int(tag & 7)}
+		switch f.wt {
+		case wireVarint:
+			if f.value, n, err = consumeVarint(b); err != nil {
+				return nil, err
+			}
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		case wireBytes:
+			l, ln, err := consumeVarint(b)
+			if err != nil {
+				return nil, err
+			}
+			if uint64(len(b)-ln) < l {
+				return nil, errTruncated
+			}
+			b = b[ln:]
+			n = int(l)
+		default:
+			return nil, fmt.Errorf("protobuf: unsupported wire type %d", f.wt)
+		}
+
+		if len(b) < n {
+			return nil, errTruncated
+		}
+		if f.wt != wireVarint {
+			f.data = b[:n]
+		}
+		b = b[n:]
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// DescriptorSet holds the messages, enums and services from a compiled
+// `FileDescriptorSet`, as produced by `protoc --descriptor_set_out` or
+// `buf build -o`. Imports must be included (`--include_imports`) for any type
+// referenced from another file.
+type DescriptorSet struct {
+	messages map[string]*messageDesc
+	enums    map[string]*enumDesc
+	methods  map[string]*methodDesc
+}
+
+type messageDesc struct {
+	name     string
+	fields   []*fieldDesc
+	byNumber map[int]*fieldDesc
+	byName   map[string]*fieldDesc
+	mapEntry bool
+	proto3   bool
+}
+
+type fieldDesc struct {
+	name     string
+	jsonName string
+	number   int
+	label    int
+	typ      int
+	typeName string
+	packed   *bool
+	oneof    bool
+	optional bool
+
+	message *messageDesc
+	enum    *enumDesc
+}
+
+type enumDesc struct {
+	name     string
+	byNumber map[int32]string
+	byName   map[string]int32
+}
+
+type methodDesc struct {
+	name            string
+	input           string
+	output          string
+	clientStreaming bool
+	serverStreaming bool
+}
+
+// LoadDescriptorSet reads a compiled `FileDescriptorSet` from a file
+func LoadDescriptorSet(p string) (*DescriptorSet, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDescriptorSet(b)
+}
+
+// ParseDescriptorSet decodes a compiled `FileDescriptorSet`
+func ParseDescriptorSet(b []byte) (*DescriptorSet, error) {
+	ds := &DescriptorSet{
+		messages: map[string]*messageDesc{},
+		enums:    map[string]*enumDesc{},
+		methods:  map[string]*methodDesc{},
+	}
+
+	files, err := parseWire(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.num == 1 && f.wt == wireBytes {
+			if err := ds.addFile(f.data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, m := range ds.messages {
+		for _, f := range m.fields {
+			name := strings.TrimPrefix(f.typeName, ".")
+			switch f.typ {
+			case typeMessage, typeGroup:
+				if f.message = ds.messages[name]; f.message == nil {
+					return nil, fmt.Errorf("protobuf: unknown message type %q in %s", name, m.name)
+				}
+			case typeEnum:
+				if f.enum = ds.enums[name]; f.enum == nil {
+					return nil, fmt.Errorf("protobuf: unknown enum type %q in %s", name, m.name)
+				}
+			}
+		}
+	}
+
+	return ds, nil
+}
+
+func (ds *DescriptorSet) addFile(b []byte) error {
+	fields, err := parseWire(b)
+	if err != nil {
+		return err
+	}
+
+	var pkg string
+	proto3 := false
+	for _, f := range fields {
+		switch f.num {
+		case 2:
+			pkg = string(f.data)
+		case 12:
+			proto3 = string(f.data) == "proto3"
+		}
+	}
+
+	for _, f := range fields {
+		var err error
+		switch f.num {
+		case 4:
+			err = ds.addMessage(pkg, f.data, proto3)
+		case 5:
+			err = ds.addEnum(pkg, f.data)
+		case 6:
+			err = ds.addService(pkg, f.data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+
+	return scope + "." + name
+}
+
+func (ds *DescriptorSet) addMessage(scope string, b []byte, proto3 bool) error {
+	fields, err := parseWire(b)
+	if err != nil {
+		return err
+	}
+
+	m := &messageDesc{
+		byNumber: map[int]*fieldDesc{},
+		byName:   map[string]*fieldDesc{},
+		proto3:   proto3,
+	}
+	for _, f := range fields {
+		if f.num == 1 {
+			m.name = qualify(scope, string(f.data))
+		}
+	}
+
+	for _, f := range fields {
+		switch f.num {
+		case 2:
+			fd, err := parseField(f.data)
+			if err != nil {
+				return err
+			}
+			m.fields = append(m.fields, fd)
+			m.byNumber[fd.number] = fd
+			m.byName[fd.name] = fd
+			m.byName[fd.jsonName] = fd
+		case 3:
+			if err := ds.addMessage(m.name, f.data, proto3); err != nil {
+				return err
+			}
+		case 4:
+			if err := ds.addEnum(m.name, f.data); err != nil {
+				return err
+			}
+		case 7:
+			opts, err := parseWire(f.data)
+			if err != nil {
+				return err
+			}
+			for _, o := range opts {
+				if o.num == 7 && o.value != 0 {
+					m.mapEntry = true
+				}
+			}
+		}
+	}
+
+	ds.messages[m.name] = m
+
+	return nil
+}
+
+func parseField(b []byte) (*fieldDesc, error) {
+	fields, err := parseWire(b)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := &fieldDesc{}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			fd.name = string(f.data)
+		case 3:
+			fd.number = int(f.value)
+		case 4:
+			fd.label = int(f.value)
+		case 5:
+			fd.typ = int(f.value)
+		case 6:
+			fd.typeName = string(f.data)
+		case 8:
+			opts, err := parseWire(f.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range opts {
+				if o.num == 2 {
+					packed := o.value != 0
+					fd.packed = &packed
+				}
+			}
+		case 9:
+			fd.oneof = true
+		case 10:
+			fd.jsonName = string(f.data)
+		case 17:
+			fd.optional = f.value != 0
+		}
+	}
+
+	if fd.jsonName == "" {
+		fd.jsonName = jsonCamelCase(fd.name)
+	}
+
+	return fd, nil
+}
+
+// jsonCamelCase derives a JSON name the way protoc does when json_name is unset
+func jsonCamelCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range s {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+func (ds *DescriptorSet) addEnum(scope string, b []byte) error {
+	fields, err := parseWire(b)
+	if err != nil {
+		return err
+	}
+
+	e := &enumDesc{byNumber: map[int32]string{}, byName: map[string]int32{}}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			e.name = qualify(scope, string(f.data))
+		case 2:
+			values, err := parseWire(f.data)
+			if err != nil {
+				return err
+			}
+			var name string
+			var number int32
+			for _, v := range values {
+				switch v.num {
+				case 1:
+					name = string(v.data)
+				case 2:
+					number = int32(v.value)
+				}
+			}
+			if _, ok := e.byNumber[number]; !ok {
+				e.byNumber[number] = name
+			}
+			e.byName[name] = number
+		}
+	}
+
+	ds.enums[e.name] = e
+
+	return nil
+}
+
+func (ds *DescriptorSet) addService(scope string, b []byte) error {
+	fields, err := parseWire(b)
+	if err != nil {
+		return err
+	}
+
+	var service string
+	for _, f := range fields {
+		if f.num == 1 {
+			service = qualify(scope, string(f.data))
+		}
+	}
+
+	for _, f := range fields {
+		if f.num != 2 {
+			continue
+		}
+
+		values, err := parseWire(f.data)
+		if err != nil {
+			return err
+		}
+		md := &methodDesc{}
+		for _, v := range values {
+			switch v.num {
+			case 1:
+				md.name = service + "/" + string(v.data)
+			case 2:
+				md.input = strings.TrimPrefix(string(v.data), ".")
+			case 3:
+				md.output = strings.TrimPrefix(string(v.data), ".")
+			case 5:
+				md.clientStreaming = v.value != 0
+			case 6:
+				md.serverStreaming = v.value != 0
+			}
+		}
+		ds.methods[md.name] = md
+	}
+
+	return nil
+}
+
+// method looks up a method by its full name, as either `pkg.Service/Method` or
+// `/pkg.Service/Method`
+func (ds *DescriptorSet) method(name string) (*methodDesc, *messageDesc, *messageDesc, error) {
+	md, ok := ds.methods[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("protobuf: unknown method %q", name)
+	}
+
+	in, out := ds.messages[md.input], ds.messages[md.output]
+	if in == nil || out == nil {
+		return nil, nil, nil, fmt.Errorf("protobuf: missing message types for method %q", name)
+	}
+
+	return md, in, out, nil
+}
+
+func (f *fieldDesc) isPacked(proto3 bool) bool {
+	switch f.typ {
+	case typeString, typeBytes, typeMessage, typeGroup:
+		return false
+	}
+	if f.packed != nil {
+		return *f.packed
+	}
+
+	return proto3
+}
+
+// marshal encodes a value as this message. The value can be anything that
+// marshals to a JSON object; fields are matched by either their proto or JSON
+// names, and values follow the protobuf JSON mapping.
+func (m *messageDesc) marshal(v interface{}) ([]byte, error) {
+	// round trip through JSON, so that structs and Go numbers work too
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := unmarshalNumbers(raw, &obj); err != nil {
+		return nil, fmt.Errorf("protobuf: %s must be given an object: %v", m.name, err)
+	}
+
+	var b []byte
+	for _, k := range sortedKeys(obj) {
+		fd, ok := m.byName[k]
+		if !ok {
+			return nil, fmt.Errorf("protobuf: unknown field %q in %s", k, m.name)
+		}
+
+		val := obj[k]
+		if val == nil {
+			continue
+		}
+
+		switch {
+		case fd.message != nil && fd.message.mapEntry:
+			entries, ok := val.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("protobuf: %s.%s must be an object", m.name, fd.name)
+			}
+			for _, ek := range sortedKeys(entries) {
+				entry, err := fd.message.marshal(map[string]interface{}{"key": ek, "value": entries[ek]})
+				if err != nil {
+					return nil, err
+				}
+				b = appendLengthDelimited(b, fd.number, entry)
+			}
+		case fd.label == labelRepeated:
+			list, ok := val.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("protobuf: %s.%s must be an array", m.name, fd.name)
+			}
+			if fd.isPacked(m.proto3) {
+				var packed []byte
+				for _, item := range list {
+					if packed, err = fd.appendValue(packed, item); err != nil {
+						return nil, err
+					}
+				}
+				b = appendLengthDelimited(b, fd.number, packed)
+				continue
+			}
+			for _, item := range list {
+				if b, err = fd.appendField(b, item); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if b, err = fd.appendField(b, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+func (f *fieldDesc) wireType() int {
+	switch f.typ {
+	case typeDouble, typeFixed64, typeSfixed64:
+		return wireFixed64
+	case typeFloat, typeFixed32, typeSfixed32:
+		return wireFixed32
+	case typeString, typeBytes, typeMessage:
+		return wireBytes
+	default:
+		return wireVarint
+	}
+}
+
+func (f *fieldDesc) appendField(b []byte, v interface{}) ([]byte, error) {
+	switch f.typ {
+	case typeString, typeBytes, typeMessage:
+		value, err := f.appendValue(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		return appendLengthDelimited(b, f.number, value), nil
+	case typeGroup:
+		return nil, fmt.Errorf("protobuf: groups are not supported (%s)", f.name)
+	default:
+		return f.appendValue(appendTag(b, f.number, f.wireType()), v)
+	}
+}
+
+// appendValue appends a single value without its tag, or for strings, bytes
+// and messages, without its length prefix
+func (f *fieldDesc) appendValue(b []byte, v interface{}) ([]byte, error) {
+	invalid := func(err error) ([]byte, error) {
+		return nil, fmt.Errorf("protobuf: invalid value %v for %s: %v", v, f.name, err)
+	}
+
+	switch f.typ {
+	case typeDouble, typeFloat:
+		n, err := protoFloat(v)
+		if err != nil {
+			return invalid(err)
+		}
+		if f.typ == typeFloat {
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(n))), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(n)), nil
+	case typeInt32, typeInt64, typeSint32, typeSint64, typeSfixed32, typeSfixed64:
+		n, err := protoInt(v)
+		if err != nil {
+			return invalid(err)
+		}
+		switch f.typ {
+		case typeSint32, typeSint64:
+			return appendVarint(b, uint64(n<<1)^uint64(n>>63)), nil
+		case typeSfixed32:
+			return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+		case typeSfixed64:
+			return binary.LittleEndian.AppendUint64(b, uint64(n)), nil
+		}
+		return appendVarint(b, uint64(n)), nil
+	case typeUint32, typeUint64, typeFixed32, typeFixed64:
+		n, err := protoUint(v)
+		if err != nil {
+			return invalid(err)
+		}
+		switch f.typ {
+		case typeFixed32:
+			return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+		case typeFixed64:
+			return binary.LittleEndian.AppendUint64(b, n), nil
+		}
+		return appendVarint(b, n), nil
+	case typeBool:
+		switch bv := v.(type) {
+		case bool:
+			if bv {
+				return appendVarint(b, 1), nil
+			}
+			return appendVarint(b, 0), nil
+		case string:
+			parsed, err := strconv.ParseBool(bv)
+			if err != nil {
+				return invalid(err)
+			}
+			return f.appendValue(b, parsed)
+		}
+		return invalid(errors.New("expected a bool"))
+	case typeEnum:
+		if name, ok := v.(string); ok {
+			n, ok := f.enum.byName[name]
+			if !ok {
+				return invalid(fmt.Errorf("not a value of %s", f.enum.name))
+			}
+			return appendVarint(b, uint64(n)), nil
+		}
+		n, err := protoInt(v)
+		if err != nil {
+			return invalid(err)
+		}
+		return appendVarint(b, uint64(n)), nil
+	case typeString:
+		s, ok := v.(string)
+		if !ok {
+			return invalid(errors.New("expected a string"))
+		}
+		return append(b, s...), nil
+	case typeBytes:
+		s, ok := v.(string)
+		if !ok {
+			return invalid(errors.New("expected a base64 string"))
+		}
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if raw, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return invalid(err)
+			}
+		}
+		return append(b, raw...), nil
+	case typeMessage:
+		msg, err := f.message.marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, msg...), nil
+	}
+
+	return nil, fmt.Errorf("protobuf: unsupported type %d for %s", f.typ, f.name)
+}
+
+func protoFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case json.Number:
+		return n.Float64()
+	case string:
+		switch n {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+		return strconv.ParseFloat(n, 64)
+	}
+
+	return 0, errors.New("expected a number")
+}
+
+func protoInt(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case float64:
+		if n != math.Trunc(n) {
+			return 0, errors.New("expected an integer")
+		}
+		return int64(n), nil
+	case json.Number:
+		return strconv.ParseInt(string(n), 10, 64)
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+
+	return 0, errors.New("expected an integer")
+}
+
+func protoUint(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case float64:
+		if n < 0 || n != math.Trunc(n) {
+			return 0, errors.New("expected an unsigned integer")
+		}
+		return uint64(n), nil
+	case json.Number:
+		return strconv.ParseUint(string(n), 10, 64)
+	case string:
+		return strconv.ParseUint(n, 10, 64)
+	}
+
+	return 0, errors.New("expected an unsigned integer")
+}
+
+// unmarshal decodes this message into the same shape that json.Unmarshal
+// produces for its JSON mapping: fields are keyed by JSON name, numbers are
+// json.Numbers, enums are names and bytes are base64. Unknown fields are
+// dropped. For proto3 messages, fields without presence are filled in with
+// their defaults, so that servers which do and don't send defaults compare
+// equal.
+func (m *messageDesc) unmarshal(b []byte) (map[string]interface{}, error) {
+	fields, err := parseWire(b)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := map[string]interface{}{}
+	for _, wf := range fields {
+		fd, ok := m.byNumber[wf.num]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case fd.message != nil && fd.message.mapEntry:
+			entry, err := fd.message.unmarshal(wf.data)
+			if err != nil {
+				return nil, err
+			}
+			entries, _ := obj[fd.jsonName].(map[string]interface{})
+			if entries == nil {
+				entries = map[string]interface{}{}
+			}
+			entries[fmt.Sprint(entry["key"])] = entry["value"]
+			obj[fd.jsonName] = entries
+		case fd.label == labelRepeated:
+			list, _ := obj[fd.jsonName].([]interface{})
+			if wf.wt == wireBytes && fd.wireType() != wireBytes {
+				values, err := fd.unpack(wf.data)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, values...)
+			} else {
+				value, err := fd.decodeValue(wf)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			obj[fd.jsonName] = list
+		default:
+			value, err := fd.decodeValue(wf)
+			if err != nil {
+				return nil, err
+			}
+			obj[fd.jsonName] = value
+		}
+	}
+
+	if m.proto3 {
+		for _, fd := range m.fields {
+			if _, ok := obj[fd.jsonName]; ok || fd.oneof || fd.optional {
+				continue
+			}
+			switch {
+			case fd.message != nil && fd.message.mapEntry:
+				obj[fd.jsonName] = map[string]interface{}{}
+			case fd.label == labelRepeated:
+				obj[fd.jsonName] = []interface{}{}
+			case fd.typ != typeMessage && fd.typ != typeGroup:
+				obj[fd.jsonName] = fd.defaultValue()
+			}
+		}
+	}
+
+	return obj, nil
+}
+
+func (f *fieldDesc) defaultValue() interface{} {
+	switch f.typ {
+	case typeBool:
+		return false
+	case typeString, typeBytes:
+		return ""
+	case typeEnum:
+		if name, ok := f.enum.byNumber[0]; ok {
+			return name
+		}
+	}
+
+	return json.Number("0")
+}
+
+// unpack decodes a packed repeated field
+func (f *fieldDesc) unpack(b []byte) ([]interface{}, error) {
+	var values []interface{}
+
+	for len(b) > 0 {
+		wf := wireField{wt: f.wireType()}
+		switch wf.wt {
+		case wireVarint:
+			v, n, err := consumeVarint(b)
+			if err != nil {
+				return nil, err
+			}
+			wf.value, b = v, b[n:]
+		case wireFixed32, wireFixed64:
+			n := 4
+			if wf.wt == wireFixed64 {
+				n = 8
+			}
+			if len(b) < n {
+				return nil, errTruncated
+			}
+			wf.data, b = b[:n], b[n:]
+		}
+
+		v, err := f.decodeValue(wf)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+func (f *fieldDesc) decodeValue(wf wireField) (interface{}, error) {
+	if wf.wt != f.wireType() {
+		return nil, fmt.Errorf("protobuf: wire type %d does not match field %s", wf.wt, f.name)
+	}
+
+	switch f.typ {
+	case typeDouble:
+		return formatProtoFloat(math.Float64frombits(binary.LittleEndian.Uint64(wf.data)), 64), nil
+	case typeFloat:
+		return formatProtoFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(wf.data))), 32), nil
+	case typeInt64:
+		return json.Number(strconv.FormatInt(int64(wf.value), 10)), nil
+	case typeInt32:
+		return json.Number(strconv.FormatInt(int64(int32(wf.value)), 10)), nil
+	case typeUint64, typeUint32:
+		return json.Number(strconv.FormatUint(wf.value, 10)), nil
+	case typeSint32, typeSint64:
+		return json.Number(strconv.FormatInt(int64(wf.value>>1)^-int64(wf.value&1), 10)), nil
+	case typeFixed32:
+		return json.Number(strconv.FormatUint(uint64(binary.LittleEndian.Uint32(wf.data)), 10)), nil
+	case typeFixed64:
+		return json.Number(strconv.FormatUint(binary.LittleEndian.Uint64(wf.data), 10)), nil
+	case typeSfixed32:
+		return json.Number(strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(wf.data))), 10)), nil
+	case typeSfixed64:
+		return json.Number(strconv.FormatInt(int64(binary.LittleEndian.Uint64(wf.data)), 10)), nil
+	case typeBool:
+		return wf.value != 0, nil
+	case typeEnum:
+		if name, ok := f.enum.byNumber[int32(wf.value)]; ok {
+			return name, nil
+		}
+		return json.Number(strconv.FormatInt(int64(int32(wf.value)), 10)), nil
+	case typeString:
+		return string(wf.data), nil
+	case typeBytes:
+		return base64.StdEncoding.EncodeToString(wf.data), nil
+	case typeMessage:
+		return f.message.unmarshal(wf.data)
+	}
+
+	return nil, fmt.Errorf("protobuf: unsupported type %d for %s", f.typ, f.name)
+}
+
+func formatProtoFloat(f float64, bits int) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+
+	return json.Number(strconv.FormatFloat(f, 'g', -1, bits))
+}
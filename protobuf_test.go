@@ -0,0 +1,194 @@
+package congruent
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func pbString(num int, s string) []byte {
+	return appendLengthDelimited(nil, num, []byte(s))
+}
+
+func pbVarint(num int, v uint64) []byte {
+	return appendVarint(appendTag(nil, num, wireVarint), v)
+}
+
+func pbJoin(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+
+	return b
+}
+
+func pbField(name string, num, label, typ int, typeName string) []byte {
+	b := pbJoin(pbString(1, name), pbVarint(3, uint64(num)), pbVarint(4, uint64(label)), pbVarint(5, uint64(typ)))
+	if typeName != "" {
+		b = append(b, pbString(6, typeName)...)
+	}
+
+	return b
+}
+
+// testDescriptorSet builds the equivalent of:
+//
+//	syntax = "proto3";
+//	package test;
+//	enum Color { RED = 0; GREEN = 1; }
+//	message Item {
+//	  message Inner { bool ok = 1; }
+//	  string display_name = 1;
+//	  int64 id = 2;
+//	  repeated int32 counts = 3;
+//	  Color color = 4;
+//	  map<string, int32> tags = 5;
+//	  Inner inner = 6;
+//	  bytes blob = 7;
+//	  double price = 8;
+//	  sint32 delta = 9;
+//	}
+//	service Items { rpc Get(Item) returns (Item); }
+func testDescriptorSet(t *testing.T) *DescriptorSet {
+	inner := pbJoin(pbString(1, "Inner"), appendLengthDelimited(nil, 2, pbField("ok", 1, 1, typeBool, "")))
+	tagsEntry := pbJoin(
+		pbString(1, "TagsEntry"),
+		appendLengthDelimited(nil, 2, pbField("key", 1, 1, typeString, "")),
+		appendLengthDelimited(nil, 2, pbField("value", 2, 1, typeInt32, "")),
+		appendLengthDelimited(nil, 7, pbVarint(7, 1)))
+
+	item := pbJoin(
+		pbString(1, "Item"),
+		appendLengthDelimited(nil, 2, pbField("display_name", 1, 1, typeString, "")),
+		appendLengthDelimited(nil, 2, pbField("id", 2, 1, typeInt64, "")),
+		appendLengthDelimited(nil, 2, pbField("counts", 3, labelRepeated, typeInt32, "")),
+		appendLengthDelimited(nil, 2, pbField("color", 4, 1, typeEnum, ".test.Color")),
+		appendLengthDelimited(nil, 2, pbField("tags", 5, labelRepeated, typeMessage, ".test.Item.TagsEntry")),
+		appendLengthDelimited(nil, 2, pbField("inner", 6, 1, typeMessage, ".test.Item.Inner")),
+		appendLengthDelimited(nil, 2, pbField("blob", 7, 1, typeBytes, "")),
+		appendLengthDelimited(nil, 2, pbField("price", 8, 1, typeDouble, "")),
+		appendLengthDelimited(nil, 2, pbField("delta", 9, 1, typeSint32, "")),
+		appendLengthDelimited(nil, 3, inner),
+		appendLengthDelimited(nil, 3, tagsEntry))
+
+	color := pbJoin(
+		pbString(1, "Color"),
+		appendLengthDelimited(nil, 2, pbJoin(pbString(1, "RED"), pbVarint(2, 0))),
+		appendLengthDelimited(nil, 2, pbJoin(pbString(1, "GREEN"), pbVarint(2, 1))))
+
+	service := pbJoin(
+		pbString(1, "Items"),
+		appendLengthDelimited(nil, 2, pbJoin(pbString(1, "Get"), pbString(2, ".test.Item"), pbString(3, ".test.Item"))))
+
+	file := pbJoin(
+		pbString(1, "test.proto"),
+		pbString(2, "test"),
+		appendLengthDelimited(nil, 4, item),
+		appendLengthDelimited(nil, 5, color),
+		appendLengthDelimited(nil, 6, service),
+		pbString(12, "proto3"))
+
+	ds, err := ParseDescriptorSet(appendLengthDelimited(nil, 1, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds
+}
+
+func TestParseDescriptorSet(t *testing.T) {
+	ds := testDescriptorSet(t)
+
+	md, in, out, err := ds.method("/test.Items/Get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.name != "test.Items/Get" || in.name != "test.Item" || out.name != "test.Item" {
+		t.Errorf("unexpected method %+v", md)
+	}
+
+	if f := in.byName["displayName"]; f == nil || f.name != "display_name" {
+		t.Errorf("expected field to be found by JSON name, got %+v", f)
+	}
+	if f := in.byNumber[5]; f.message == nil || !f.message.mapEntry {
+		t.Errorf("expected tags to be a map, got %+v", f)
+	}
+
+	if _, _, _, err := ds.method("test.Items/Missing"); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	ds := testDescriptorSet(t)
+	item := ds.messages["test.Item"]
+
+	in := map[string]interface{}{
+		"display_name": "widget",
+		"id":           "9007199254740993",
+		"counts":       []interface{}{1, -2, 3},
+		"color":        "GREEN",
+		"tags":         map[string]interface{}{"a": 1, "b": 2},
+		"inner":        map[string]interface{}{"ok": true},
+		"blob":         "aGk=",
+		"price":        19.99,
+		"delta":        -5,
+	}
+
+	b, err := item.marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := item.unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"displayName": "widget",
+		"id":          json.Number("9007199254740993"),
+		"counts":      []interface{}{json.Number("1"), json.Number("-2"), json.Number("3")},
+		"color":       "GREEN",
+		"tags":        map[string]interface{}{"a": json.Number("1"), "b": json.Number("2")},
+		"inner":       map[string]interface{}{"ok": true},
+		"blob":        "aGk=",
+		"price":       json.Number("19.99"),
+		"delta":       json.Number("-5"),
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+}
+
+func TestMessageDefaults(t *testing.T) {
+	ds := testDescriptorSet(t)
+	item := ds.messages["test.Item"]
+
+	out, err := item.unmarshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"displayName": "",
+		"id":          json.Number("0"),
+		"counts":      []interface{}{},
+		"color":       "RED",
+		"tags":        map[string]interface{}{},
+		"blob":        "",
+		"price":       json.Number("0"),
+		"delta":       json.Number("0"),
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+
+	if _, err := item.marshal(map[string]interface{}{"nope": 1}); err == nil {
+		t.Error("Expected error for an unknown field, but got none!")
+	}
+	if _, err := item.marshal(map[string]interface{}{"color": "BLUE"}); err == nil {
+		t.Error("Expected error for an unknown enum value, but got none!")
+	}
+}
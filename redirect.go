@@ -0,0 +1,161 @@
+package congruent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RedirectMode controls how a Request handles redirects
+type RedirectMode int
+
+const (
+	// RedirectFollow follows redirects, as http.Client does by default
+	RedirectFollow RedirectMode = iota
+	// RedirectNone doesn't follow redirects; the redirect itself is returned
+	RedirectNone
+	// RedirectRecord follows redirects, recording each one on the Response
+	RedirectRecord
+)
+
+// maxRedirects matches the limit used by http.Client
+const maxRedirects = 10
+
+// HostPlaceholder replaces a server's own scheme and host when comparing
+// redirect locations, so that a redirect to `http://localhost:3000/login` and
+// one to `https://example.com/login` compare the same.
+const HostPlaceholder = "{host}"
+
+// Redirect is a single redirect received while making a Request; URL is the
+// address which responded with it.
+type Redirect struct {
+	URL        *url.URL
+	StatusCode int
+	Location   string
+}
+
+func (m RedirectMode) checkRedirect(redirects *[]Redirect) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if m == RedirectNone {
+			return http.ErrUseLastResponse
+		}
+
+		if m == RedirectRecord && req.Response != nil {
+			*redirects = append(*redirects, Redirect{
+				URL:        via[len(via)-1].URL,
+				StatusCode: req.Response.StatusCode,
+				Location:   req.Response.Header.Get("Location"),
+			})
+		}
+
+		if len(via) >= maxRedirects {
+			return errors.New("stopped after 10 redirects")
+		}
+
+		return nil
+	}
+}
+
+// neutralLocation resolves a `Location` against the URL it was received from,
+// then swaps the server's own scheme and host for HostPlaceholder
+func (r *Response) neutralLocation(base *url.URL, loc string) string {
+	if loc == "" {
+		return ""
+	}
+
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	own := map[string]bool{}
+	if r.Request != nil && r.Request.URL != nil {
+		own[r.Request.URL.Host] = true
+	}
+	if r.Server != nil {
+		if su, err := url.Parse(r.Server.BaseURI); err == nil {
+			own[su.Host] = true
+		}
+	}
+
+	if own[u.Host] {
+		u.Scheme, u.Host = "", ""
+		return HostPlaceholder + u.String()
+	}
+
+	return u.String()
+}
+
+// LocationSame verifies that every response has the same `Location` header,
+// after resolving it and replacing the server's own host with HostPlaceholder.
+// This is mostly useful with RedirectNone.
+func (r Responses) LocationSame() (err error) {
+	defer r.reproducible(&err)
+
+	if len(r) < 2 {
+		return nil
+	}
+
+	location := func(resp *Response) string {
+		if resp.Headers == nil {
+			return ""
+		}
+		return resp.neutralLocation(resp.Request.URL, resp.Headers.Get("Location"))
+	}
+
+	expected := location(r[0])
+	for _, resp := range r[1:] {
+		if loc := location(resp); loc != expected {
+			return fmt.Errorf(
+				"(%s)%s: Location was %q, expected %q",
+				resp.Request.Method, resp.Request.URL, loc, expected)
+		}
+	}
+
+	return nil
+}
+
+// RedirectsSame verifies that every response followed the same chain of
+// redirects, comparing status codes and locations the way LocationSame does.
+// Redirects are only available for requests made with RedirectRecord.
+func (r Responses) RedirectsSame() (err error) {
+	defer r.reproducible(&err)
+
+	if len(r) < 2 {
+		return nil
+	}
+
+	chain := func(resp *Response) []string {
+		var c []string
+		for _, rd := range resp.Redirects {
+			c = append(c, fmt.Sprintf("%d %s", rd.StatusCode, resp.neutralLocation(rd.URL, rd.Location)))
+		}
+		return c
+	}
+
+	expected := chain(r[0])
+	for _, resp := range r[1:] {
+		method, url := resp.Request.Method, resp.Request.URL
+		got := chain(resp)
+
+		if lg, le := len(got), len(expected); lg != le {
+			return fmt.Errorf(
+				"(%s)%s: Followed %d redirects %v, expected %d %v",
+				method, url, lg, got, le, expected)
+		}
+
+		for i := range got {
+			if got[i] != expected[i] {
+				return fmt.Errorf(
+					"(%s)%s: Expected redirect %d to be %q, was %q",
+					method, url, i, expected[i], got[i])
+			}
+		}
+	}
+
+	return nil
+}
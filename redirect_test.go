@@ -0,0 +1,96 @@
+package congruent
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// redirectServer redirects `/start` to `next`, and serves the same page from
+// everywhere else; when absolute is set, redirects carry the server's own host
+func redirectServer(next string, absolute bool) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			loc := next
+			if absolute {
+				loc = ts.URL + next
+			}
+			http.Redirect(w, r, loc, http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "page")
+	}))
+
+	return ts
+}
+
+func TestRedirects(t *testing.T) {
+	ts0 := redirectServer("/landing", false)
+	defer ts0.Close()
+	ts1 := redirectServer("/landing", true)
+	defer ts1.Close()
+	ts2 := redirectServer("/wrong", false)
+	defer ts2.Close()
+
+	request := NewRequest("GET", "/start", nil, nil)
+
+	good := Servers{NewServer(ts0.URL, nil), NewServer(ts1.URL, nil)}
+	bad := Servers{NewServer(ts0.URL, nil), NewServer(ts2.URL, nil)}
+
+	// by default, redirects are followed and the wrong one goes unnoticed
+	responses, err := bad.Request(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.BodySame(); err != nil {
+		t.Error(err)
+	}
+	if len(responses[0].Redirects) != 0 {
+		t.Error("expected redirects not to be recorded")
+	}
+
+	request.Redirect = RedirectRecord
+	responses, err = good.Request(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.RedirectsSame(); err != nil {
+		t.Error(err)
+	}
+	if l := len(responses[0].Redirects); l != 1 {
+		t.Errorf("expected 1 redirect to be recorded, got %d", l)
+	}
+
+	responses, err = bad.Request(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.RedirectsSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), HostPlaceholder+"/wrong") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	request.Redirect = RedirectNone
+	responses, err = good.Request(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.StatusEqual(http.StatusFound); err != nil {
+		t.Error(err)
+	}
+	if err := responses.LocationSame(); err != nil {
+		t.Error(err)
+	}
+
+	responses, err = bad.Request(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.LocationSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
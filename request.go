@@ -8,9 +8,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/fardog/congruent/urljoin"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 // NewServer creates a new server definition
@@ -18,23 +21,46 @@ func NewServer(u string, h *http.Header) *Server {
 	return &Server{BaseURI: u, Headers: h}
 }
 
-// Server represents a server that will be requested against
+// Server represents a server that will be requested against. Aliases are other
+// base URLs the server is known by, such as a public hostname, which
+// NormalizeURLs treats the same as BaseURI. Name, if set, is used in place of
+// BaseURI in reports, like "node-3". Middleware rewrites every request to the
+// server, in order, before it is sent; that includes WebSocket handshakes and
+// gRPC calls, whose body is the length-prefixed message.
 type Server struct {
-	BaseURI string
-	Headers *http.Header
+	Name       string
+	BaseURI    string
+	Headers    *http.Header
+	Aliases    []string
+	Middleware []Middleware
+}
+
+// String returns the server's Name, or its BaseURI if it has none
+func (s *Server) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return s.BaseURI
 }
 
 // NewRequest creates a new request to be made against a Server
 func NewRequest(m, p string, h *http.Header, b interface{}) *Request {
-	return &Request{m, p, h, b}
+	return &Request{Method: m, Path: p, Headers: h, Body: b}
 }
 
-// Request represents a test case to be run
+// Request represents a test case to be run. Redirect controls whether redirects
+// are followed; by default they are, without being recorded. Retry, if set,
+// retries transport errors and the statuses it lists. Name, if set, names the
+// case in test output in place of its method and path.
 type Request struct {
-	Method  string
-	Path    string
-	Headers *http.Header
-	Body    interface{}
+	Name     string
+	Method   string
+	Path     string
+	Headers  *http.Header
+	Body     interface{}
+	Redirect RedirectMode
+	Retry    *RetryPolicy
 }
 
 // PrepareBody sets the body for a Request; can take a string, or any object which
@@ -56,16 +82,22 @@ func (r Request) PrepareBody() (*bytes.Buffer, error) {
 
 }
 
-// Do performs a Request and returns a Response
-func (r Request) Do(s *Server) (*Response, error) {
+// newHTTPRequest builds the http.Request that will be sent to a Server, with
+// the Server's and the Request's headers merged in that order, then rewritten
+// by the Server's middleware
+func (r Request) newHTTPRequest(s *Server) (*http.Request, error) {
 	uri := urljoin.Join(s.BaseURI + r.Path)
 
-	reqBody, err := r.PrepareBody()
-	if err != nil {
-		return nil, err
+	// a Request without a Body sends none, rather than JSON null
+	var reqBody io.Reader
+	if r.Body != nil {
+		buf, err := r.PrepareBody()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = buf
 	}
 
-	client := &http.Client{}
 	req, err := http.NewRequest(r.Method, uri, reqBody)
 	if err != nil {
 		return nil, err
@@ -73,31 +105,95 @@ func (r Request) Do(s *Server) (*Response, error) {
 
 	mergeHTTPHeaders(&req.Header, s.Headers, r.Headers)
 
+	if err := s.rewrite(req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Do performs a Request and returns a Response. With a Retry policy, failed
+// attempts are retried with backoff, and Response.Attempts counts them all.
+func (r Request) Do(s *Server) (*Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := r.do(s)
+		if !r.Retry.retry(attempt, resp, err) {
+			if resp != nil {
+				resp.Attempts = attempt
+			}
+			return resp, err
+		}
+
+		time.Sleep(r.Retry.backoff(attempt))
+	}
+}
+
+func (r Request) do(s *Server) (*Response, error) {
+	req, err := r.newHTTPRequest(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// setting this ourselves stops the transport from decompressing gzip
+	// transparently, which would hide the `Content-Encoding` the server chose
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding())
+	}
+
+	var redirects []Redirect
+	client := &http.Client{CheckRedirect: r.Redirect.checkRedirect(&redirects)}
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	raw, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
+	duration := time.Since(start)
 
-	return &Response{req, &resp.Header, body, resp.StatusCode}, nil
+	// responses which can't have a body keep the `Content-Encoding` it would
+	// have had, so there is nothing to decode
+	body := raw
+	if hasBody(req.Method, resp.StatusCode, raw) {
+		body, err = decodeBody(resp.Header.Get("Content-Encoding"), raw)
+		if err != nil {
+			return nil, fmt.Errorf("(%s)%s: %v", req.Method, req.URL, err)
+		}
+	}
+
+	return &Response{
+		Request:    req,
+		Headers:    &resp.Header,
+		Body:       body,
+		StatusCode: resp.StatusCode,
+		RawSize:    len(raw),
+		Server:     s,
+		Redirects:  redirects,
+		Duration:   duration,
+	}, nil
 }
 
-// Response represents a response from a server
+// Response represents a response from a server. Body is always decoded; the
+// number of bytes received before removing any `Content-Encoding` is kept in
+// RawSize. Redirects is only filled in when the Request asked for them to be
+// recorded. Duration is the time taken to send the request and read the whole
+// response, including any redirects, for the last attempt; Attempts is how
+// many attempts were made, which is only more than one if the Request had a
+// Retry policy.
 type Response struct {
 	Request    *http.Request
 	Headers    *http.Header
 	Body       []byte
 	StatusCode int
-}
-
-type result struct {
-	resp *Response
-	err  error
+	RawSize    int
+	Server     *Server
+	Redirects  []Redirect
+	Duration   time.Duration
+	Attempts   int
 }
 
 // Servers is an array of Server pointers
@@ -106,33 +202,48 @@ type Servers []*Server
 // Requests is an array of Request pointers
 type Requests []*Request
 
-// Request makes a Request against a list of servers, and returns responses
+// Request makes a Request against a list of servers, and returns responses in
+// the same order as the servers, so that the first server's response can be
+// treated as the baseline
 func (s Servers) Request(r *Request) (Responses, error) {
-	var responses Responses
-	var errors []string
-
-	results := make(chan result, 4)
-
-	for _, server := range s {
-		go func(server *Server) {
-			resp, err := r.Do(server)
-			results <- result{resp, err}
-		}(server)
+	responses := make(Responses, len(s))
+	err := s.each(func(i int, server *Server) (err error) {
+		responses[i], err = r.Do(server)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for i := 0; i < len(s); i++ {
-		result := <-results
+	return responses, nil
+}
 
-		responses = append(responses, result.resp)
+// each calls fn for every server at once, with the server's index so that
+// results can be kept in server order, and waits for them all; the errors of
+// any which failed are combined, also in server order
+func (s Servers) each(fn func(i int, server *Server) error) error {
+	errs := make([]error, len(s))
+
+	var wg sync.WaitGroup
+	for i, server := range s {
+		wg.Add(1)
+		go func(i int, server *Server) {
+			defer wg.Done()
+			errs[i] = fn(i, server)
+		}(i, server)
+	}
+	wg.Wait()
 
-		if result.err != nil {
-			errors = append(errors, result.err.Error())
+	var errors []string
+	for _, err := range errs {
+		if err != nil {
+			errors = append(errors, err.Error())
 		}
 	}
 
 	if len(errors) > 0 {
-		return nil, fmt.Errorf("got errors: %v", strings.Join(errors, "\t\n"))
+		return fmt.Errorf("got errors: %v", strings.Join(errors, "\t\n"))
 	}
 
-	return responses, nil
+	return nil
 }
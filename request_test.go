@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"sort"
 	"testing"
+	"time"
 )
 
 func TestPrepareBodyString(t *testing.T) {
@@ -109,3 +110,27 @@ func TestRequest(t *testing.T) {
 		t.Errorf(`Expected "b", got %s`, resp[1])
 	}
 }
+
+func TestRequestKeepsServerOrder(t *testing.T) {
+	var servers Servers
+	for _, delay := range []time.Duration{30, 0, 15} {
+		d := delay * time.Millisecond
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(d)
+			fmt.Fprint(w, d)
+		}))
+		defer ts.Close()
+		servers = append(servers, NewServer(ts.URL, nil))
+	}
+
+	responses, err := servers.Request(NewRequest("GET", "/", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, resp := range responses {
+		if resp.Server != servers[i] {
+			t.Errorf("response %d came from the wrong server: %s", i, resp.Body)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package congruent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryBackoff is the wait before the first retry when a RetryPolicy
+// doesn't set one
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// RetryPolicy retries a Request which fails in a way that's likely to pass on
+// another try: a timeout, a refused or reset connection, or one of Statuses,
+// such as a 502 from a load balancer. Attempts is the most attempts made in
+// total, including the first. The wait before each retry starts at Backoff and
+// doubles each time, up to MaxBackoff if that is set.
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Statuses   []int
+}
+
+// retry reports whether another attempt should follow this one
+func (p *RetryPolicy) retry(attempt int, resp *Response, err error) bool {
+	if p == nil || attempt >= p.Attempts {
+		return false
+	}
+
+	if err != nil {
+		return transientError(err)
+	}
+
+	for _, status := range p.Statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff is the wait after a failed attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return d
+}
+
+// transientError reports whether an error is a timeout, or a connection which
+// was refused, reset, or cut off partway through a response. Anything else,
+// like an unknown host or an unsupported URL scheme, would fail the same way
+// every time.
+func transientError(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Flakiness classifies how a mismatch behaves when it is run again
+type Flakiness int
+
+const (
+	// FlakeNone means no run failed
+	FlakeNone Flakiness = iota
+	// FlakeIntermittent means some runs failed and others passed
+	FlakeIntermittent
+	// FlakeConsistent means every run failed
+	FlakeConsistent
+)
+
+func (f Flakiness) String() string {
+	switch f {
+	case FlakeNone:
+		return "passing"
+	case FlakeIntermittent:
+		return "intermittent"
+	case FlakeConsistent:
+		return "consistent"
+	}
+
+	return fmt.Sprintf("Flakiness(%d)", int(f))
+}
+
+// FlakeReport is the outcome of re-running a request. Errors has an entry for
+// every run, nil for those where the servers agreed.
+type FlakeReport struct {
+	Runs           int
+	Failures       int
+	Errors         []error
+	Classification Flakiness
+}
+
+// String summarizes the report, with the first failure if there was one
+func (f FlakeReport) String() string {
+	s := fmt.Sprintf("%s: %d of %d runs failed", f.Classification, f.Failures, f.Runs)
+	for _, err := range f.Errors {
+		if err != nil {
+			s += "\nfirst failure: " + strings.Replace(err.Error(), "\n", "\n  ", -1)
+			break
+		}
+	}
+
+	return s
+}
+
+// Classify sends a request to all servers `n` times, running the assertions
+// each time, and reports whether the servers disagree consistently or only
+// intermittently. With no assertions, the servers must agree on status and
+// body content.
+func Classify(s Servers, r *Request, n int, assertions ...Assertion) FlakeReport {
+	if len(assertions) == 0 {
+		assertions = defaultAssertions()
+	}
+
+	report := FlakeReport{Runs: n}
+	for i := 0; i < n; i++ {
+		err := differ(s, r, assertions)
+		if err != nil {
+			report.Failures++
+		}
+		report.Errors = append(report.Errors, err)
+	}
+
+	switch {
+	case report.Failures == 0:
+		report.Classification = FlakeNone
+	case report.Failures < report.Runs:
+		report.Classification = FlakeIntermittent
+	default:
+		report.Classification = FlakeConsistent
+	}
+
+	return report
+}
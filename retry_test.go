@@ -0,0 +1,175 @@
+package congruent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(502)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	server := NewServer(ts.URL, nil)
+	req := NewRequest("GET", "/", nil, nil)
+
+	resp, err := req.Do(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 502 || resp.Attempts != 1 {
+		t.Errorf("expected a single 502 without retries, got %d after %d", resp.StatusCode, resp.Attempts)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	req.Retry = &RetryPolicy{Attempts: 5, Backoff: time.Millisecond, Statuses: []int{502}}
+	resp, err = req.Do(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || resp.Attempts != 3 || string(resp.Body) != "ok" {
+		t.Errorf("expected a 200 after 3 attempts, got %d after %d", resp.StatusCode, resp.Attempts)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	req.Retry.Attempts = 2
+	resp, err = req.Do(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 502 || resp.Attempts != 2 {
+		t.Errorf("expected a 502 after 2 attempts, got %d after %d", resp.StatusCode, resp.Attempts)
+	}
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	u := ts.URL
+	ts.Close()
+
+	req := NewRequest("GET", "/", nil, nil)
+	req.Retry = &RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	start := time.Now()
+	if _, err := req.Do(NewServer(u, nil)); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+	// two waits, of 1ms then 2ms
+	if elapsed := time.Since(start); elapsed < 3*time.Millisecond {
+		t.Errorf("expected to have backed off, took %v", elapsed)
+	}
+
+	if transientError(errors.New("bad request")) {
+		t.Error("expected a plain error not to be transient")
+	}
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	req := NewRequest("GET", "/", nil, nil)
+	req.Retry = &RetryPolicy{Attempts: 3, Backoff: time.Second}
+
+	start := time.Now()
+	if _, err := req.Do(NewServer("ftp://localhost", nil)); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "unsupported protocol scheme") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected no retries, took %v", elapsed)
+	}
+
+	for _, err := range []error{
+		&url.Error{Op: "Get", URL: "ftp://localhost", Err: errors.New("unsupported protocol scheme")},
+		&url.Error{Op: "Get", URL: "http://localhost", Err: errors.New("stopped after 10 redirects")},
+		&url.Error{Op: "Get", URL: "http://nowhere.invalid", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}}},
+	} {
+		if transientError(err) {
+			t.Errorf("expected %v not to be transient", err)
+		}
+	}
+	for _, err := range []error{
+		&url.Error{Op: "Get", URL: "http://localhost", Err: io.ErrUnexpectedEOF},
+		&url.Error{Op: "Get", URL: "http://localhost", Err: fmt.Errorf("read: %w", syscall.ECONNRESET)},
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		&url.Error{Op: "Get", URL: "http://localhost", Err: &net.DNSError{Err: "i/o timeout", Name: "localhost", IsTimeout: true}},
+	} {
+		if !transientError(err) {
+			t.Errorf("expected %v to be transient", err)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	expected := []time.Duration{10, 20, 40, 50, 50}
+	for i, e := range expected {
+		if d := p.backoff(i + 1); d != e*time.Millisecond {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, e*time.Millisecond, d)
+		}
+	}
+
+	if d := (&RetryPolicy{}).backoff(1); d != DefaultRetryBackoff {
+		t.Errorf("expected %v, got %v", DefaultRetryBackoff, d)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	var calls int32
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer stable.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 0 {
+			w.WriteHeader(500)
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer flaky.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer broken.Close()
+
+	req := NewRequest("GET", "/", nil, nil)
+	stableServer := NewServer(stable.URL, nil)
+
+	cases := []struct {
+		server   string
+		expected Flakiness
+		failures int
+	}{
+		{stable.URL, FlakeNone, 0},
+		{flaky.URL, FlakeIntermittent, 2},
+		{broken.URL, FlakeConsistent, 4},
+	}
+
+	for _, c := range cases {
+		report := Classify(Servers{stableServer, NewServer(c.server, nil)}, req, 4, Responses.StatusSame)
+		if report.Classification != c.expected || report.Failures != c.failures || len(report.Errors) != 4 {
+			t.Errorf("expected %s with %d failures, got %s", c.expected, c.failures, report)
+		}
+	}
+
+	report := Classify(Servers{stableServer, NewServer(broken.URL, nil)}, req, 2)
+	if s := report.String(); !strings.HasPrefix(s, "consistent: 2 of 2 runs failed\nfirst failure: servers disagreed") {
+		t.Errorf("unexpected report %q", s)
+	}
+}
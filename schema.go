@@ -0,0 +1,778 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// defaultSchemaBase is the base URI of a schema which has no `$id`, and wasn't
+// loaded from a file
+const defaultSchemaBase = "congruent:///schema.json"
+
+// Schema is a JSON Schema (draft 2020-12) which response bodies can be
+// validated against. Every keyword that asserts something is supported, apart
+// from `format`, which the draft treats as an annotation. `$dynamicRef` is
+// handled as a plain `$ref`, and only references within the same document can
+// be resolved.
+type Schema struct {
+	root      interface{}
+	base      *url.URL
+	resources map[string]schemaResource
+	anchors   map[string]schemaResource
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// SchemaError is a single schema violation. InstancePath locates the failing
+// value, as `$.items[0].id`, and KeywordLocation locates the failing keyword
+// within the schema, as a JSON pointer.
+type SchemaError struct {
+	InstancePath    string
+	Keyword         string
+	KeywordLocation string
+	Message         string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s (%s at %s)", e.InstancePath, e.Message, e.Keyword, e.KeywordLocation)
+}
+
+// LoadSchema reads a JSON Schema from a file
+func LoadSchema(p string) (*Schema, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSchema(b, (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String())
+}
+
+// ParseSchema reads a JSON Schema from its JSON encoding
+func ParseSchema(b []byte) (*Schema, error) {
+	return parseSchema(b, defaultSchemaBase)
+}
+
+func parseSchema(b []byte, base string) (*Schema, error) {
+	var root interface{}
+	if err := unmarshalNumbers(b, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+
+	return newSchema(root, base)
+}
+
+func newSchema(root interface{}, base string) (*Schema, error) {
+	bu, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{
+		root:      root,
+		resources: map[string]schemaResource{},
+		anchors:   map[string]schemaResource{},
+		patterns:  map[string]*regexp.Regexp{},
+	}
+	s.base = bu
+	s.resources[withoutFragment(bu)] = schemaResource{root, bu}
+	if err := s.index(bu, root); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// schemaResource is a schema that can be referred to directly, with the base
+// URI it is rebased from: that of the schema containing it
+type schemaResource struct {
+	node   interface{}
+	parent *url.URL
+}
+
+func withoutFragment(u *url.URL) string {
+	c := *u
+	c.Fragment, c.RawFragment = "", ""
+
+	return c.String()
+}
+
+// rebase returns the base URI in effect within a schema, taking its `$id`
+// into account
+func (s *Schema) rebase(base *url.URL, node interface{}) *url.URL {
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return base
+	}
+
+	id, ok := obj["$id"].(string)
+	if !ok {
+		return base
+	}
+
+	ref, err := url.Parse(id)
+	if err != nil {
+		return base
+	}
+
+	return base.ResolveReference(ref)
+}
+
+// index records every schema resource (`$id`) and anchor, so that references
+// to them can be resolved; parent is the base URI of the schema containing
+// node
+func (s *Schema) index(parent *url.URL, node interface{}) error {
+	base := s.rebase(parent, node)
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if _, ok := n["$id"]; ok {
+			s.resources[withoutFragment(base)] = schemaResource{n, parent}
+		}
+		for _, kw := range []string{"$anchor", "$dynamicAnchor"} {
+			if a, ok := n[kw].(string); ok {
+				s.anchors[withoutFragment(base)+"#"+a] = schemaResource{n, parent}
+			}
+		}
+
+		for _, k := range sortedKeys(n) {
+			switch k {
+			case "enum", "const", "examples", "default":
+				continue
+			}
+			if err := s.index(base, n[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range n {
+			if err := s.index(base, child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolve finds the schema that a `$ref` points at, and the base URI of the
+// schema containing it, which validate rebases from
+func (s *Schema) resolve(base *url.URL, ref string) (interface{}, *url.URL, error) {
+	ru, err := url.Parse(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := base.ResolveReference(ru)
+
+	resource, ok := s.resources[withoutFragment(target)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+
+	frag := target.Fragment
+	switch {
+	case frag == "":
+		return resource.node, resource.parent, nil
+	case strings.HasPrefix(frag, "/"):
+		node := resource.node
+		for _, tok := range strings.Split(frag[1:], "/") {
+			tok = strings.Replace(strings.Replace(tok, "~1", "/", -1), "~0", "~", -1)
+			switch n := node.(type) {
+			case map[string]interface{}:
+				if node, ok = n[tok]; !ok {
+					return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(tok)
+				if err != nil || i < 0 || i >= len(n) {
+					return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+				}
+				node = n[i]
+			default:
+				return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+		}
+		return node, s.rebase(resource.parent, resource.node), nil
+	default:
+		anchor, ok := s.anchors[withoutFragment(target)+"#"+frag]
+		if !ok {
+			return nil, nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		return anchor.node, anchor.parent, nil
+	}
+}
+
+func (s *Schema) pattern(p string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if re, ok := s.patterns[p]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+	}
+	s.patterns[p] = re
+
+	return re, nil
+}
+
+// Validate checks a decoded value against the schema, returning every
+// violation found. The value should be decoded with json.Decoder.UseNumber for
+// exact numeric checks, though float64s are accepted too.
+func (s *Schema) Validate(v interface{}) []SchemaError {
+	errs, _ := s.validate(map[string]bool{}, s.root, s.base, v, nil, "#")
+
+	return errs
+}
+
+// ValidateJSON decodes a JSON document and validates it against the schema
+func (s *Schema) ValidateJSON(b []byte) ([]SchemaError, error) {
+	var v interface{}
+	if err := unmarshalNumbers(b, &v); err != nil {
+		return nil, err
+	}
+
+	return s.Validate(v), nil
+}
+
+// evaluated tracks which properties and items of an instance a schema looked
+// at, for `unevaluatedProperties` and `unevaluatedItems`
+type evaluated struct {
+	props    map[string]bool
+	items    int
+	allItems bool
+}
+
+func (e *evaluated) merge(o *evaluated) {
+	if o == nil {
+		return
+	}
+	for k := range o.props {
+		e.props[k] = true
+	}
+	if o.items > e.items {
+		e.items = o.items
+	}
+	e.allItems = e.allItems || o.allItems
+}
+
+// validate applies a schema to an instance. active holds the references being
+// followed, each as the schema reached and the instance location, so that a
+// reference which leads back to itself is caught rather than followed forever.
+func (s *Schema) validate(active map[string]bool, node interface{}, base *url.URL, inst interface{}, at []interface{}, kw string) ([]SchemaError, *evaluated) {
+	ev := &evaluated{props: map[string]bool{}}
+
+	fail := func(keyword, format string, args ...interface{}) SchemaError {
+		return SchemaError{
+			InstancePath:    formatLocation(at),
+			Keyword:         keyword,
+			KeywordLocation: kw + "/" + keyword,
+			Message:         fmt.Sprintf(format, args...),
+		}
+	}
+
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			return []SchemaError{{
+				InstancePath:    formatLocation(at),
+				Keyword:         "false",
+				KeywordLocation: kw,
+				Message:         "no value is allowed here",
+			}}, ev
+		}
+		return nil, ev
+	case map[string]interface{}:
+	default:
+		return []SchemaError{fail("schema", "schema must be an object or boolean")}, ev
+	}
+
+	obj := node.(map[string]interface{})
+	base = s.rebase(base, obj)
+
+	var errs []SchemaError
+	inPlace := func(child interface{}, childKw string) ([]SchemaError, *evaluated) {
+		return s.validate(active, child, base, inst, at, childKw)
+	}
+	// sub applies a schema to the same instance, as allOf does, keeping track
+	// of what it evaluated when it passes
+	sub := func(child interface{}, childKw string) {
+		e, cev := inPlace(child, childKw)
+		if len(e) == 0 {
+			ev.merge(cev)
+		}
+		errs = append(errs, e...)
+	}
+
+	for _, ref := range []string{"$ref", "$dynamicRef"} {
+		r, ok := obj[ref].(string)
+		if !ok {
+			continue
+		}
+		target, tbase, err := s.resolve(base, r)
+		if err != nil {
+			errs = append(errs, fail(ref, "%v", err))
+			continue
+		}
+		key := fmt.Sprintf("%p %s", target, formatLocation(at))
+		if active[key] {
+			errs = append(errs, fail(ref, "$ref %q leads back to itself for the same value", r))
+			continue
+		}
+		active[key] = true
+		e, cev := s.validate(active, target, tbase, inst, at, kw+"/"+ref)
+		delete(active, key)
+		if len(e) == 0 {
+			ev.merge(cev)
+		}
+		errs = append(errs, e...)
+	}
+
+	if t, ok := obj["type"]; ok {
+		var types []string
+		switch tv := t.(type) {
+		case string:
+			types = []string{tv}
+		case []interface{}:
+			for _, x := range tv {
+				if s, ok := x.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		// OpenAPI 3.0 schemas say `nullable` rather than adding a "null" type
+		matched := inst == nil && obj["nullable"] == true
+		for _, typ := range types {
+			if jsonTypeIs(inst, typ) {
+				matched = true
+			}
+		}
+		if !matched {
+			errs = append(errs, fail("type", "expected %s, was %s", strings.Join(types, " or "), jsonType(inst)))
+		}
+	}
+
+	if e, ok := obj["enum"].([]interface{}); ok {
+		found := false
+		for _, v := range e {
+			if jsonEqual(inst, v) {
+				found = true
+			}
+		}
+		if !found {
+			errs = append(errs, fail("enum", "%s is not one of %s", formatValue(inst), formatValue(e)))
+		}
+	}
+
+	if c, ok := obj["const"]; ok && !jsonEqual(inst, c) {
+		errs = append(errs, fail("const", "expected %s, was %s", formatValue(c), formatValue(inst)))
+	}
+
+	if num, ok := jsonRat(inst); ok {
+		if m, ok := jsonRat(obj["multipleOf"]); ok && m.Sign() > 0 {
+			if !new(big.Rat).Quo(num, m).IsInt() {
+				errs = append(errs, fail("multipleOf", "%s is not a multiple of %s", num.RatString(), m.RatString()))
+			}
+		}
+		if m, ok := jsonRat(obj["maximum"]); ok && num.Cmp(m) > 0 {
+			errs = append(errs, fail("maximum", "%s is greater than %s", num.RatString(), m.RatString()))
+		}
+		if m, ok := jsonRat(obj["exclusiveMaximum"]); ok && num.Cmp(m) >= 0 {
+			errs = append(errs, fail("exclusiveMaximum", "%s is not less than %s", num.RatString(), m.RatString()))
+		}
+		if m, ok := jsonRat(obj["minimum"]); ok && num.Cmp(m) < 0 {
+			errs = append(errs, fail("minimum", "%s is less than %s", num.RatString(), m.RatString()))
+		}
+		if m, ok := jsonRat(obj["exclusiveMinimum"]); ok && num.Cmp(m) <= 0 {
+			errs = append(errs, fail("exclusiveMinimum", "%s is not greater than %s", num.RatString(), m.RatString()))
+		}
+	}
+
+	if str, ok := inst.(string); ok {
+		l := utf8.RuneCountInString(str)
+		if m, ok := jsonInt(obj["maxLength"]); ok && l > m {
+			errs = append(errs, fail("maxLength", "length %d is greater than %d", l, m))
+		}
+		if m, ok := jsonInt(obj["minLength"]); ok && l < m {
+			errs = append(errs, fail("minLength", "length %d is less than %d", l, m))
+		}
+		if p, ok := obj["pattern"].(string); ok {
+			re, err := s.pattern(p)
+			if err != nil {
+				errs = append(errs, fail("pattern", "%v", err))
+			} else if !re.MatchString(str) {
+				errs = append(errs, fail("pattern", "%q does not match %q", str, p))
+			}
+		}
+	}
+
+	if arr, ok := inst.([]interface{}); ok {
+		if m, ok := jsonInt(obj["maxItems"]); ok && len(arr) > m {
+			errs = append(errs, fail("maxItems", "%d items is more than %d", len(arr), m))
+		}
+		if m, ok := jsonInt(obj["minItems"]); ok && len(arr) < m {
+			errs = append(errs, fail("minItems", "%d items is fewer than %d", len(arr), m))
+		}
+		if u, ok := obj["uniqueItems"].(bool); ok && u {
+		unique:
+			for i := range arr {
+				for j := 0; j < i; j++ {
+					if jsonEqual(arr[i], arr[j]) {
+						errs = append(errs, fail("uniqueItems", "items %d and %d are equal", j, i))
+						break unique
+					}
+				}
+			}
+		}
+
+		prefix := 0
+		if p, ok := obj["prefixItems"].([]interface{}); ok {
+			for i, ps := range p {
+				if i >= len(arr) {
+					break
+				}
+				e, _ := s.validate(active, ps, base, arr[i], appendLocation(at, i), fmt.Sprintf("%s/prefixItems/%d", kw, i))
+				errs = append(errs, e...)
+				prefix = i + 1
+			}
+			if prefix > ev.items {
+				ev.items = prefix
+			}
+		}
+		if items, ok := obj["items"]; ok {
+			for i := prefix; i < len(arr); i++ {
+				e, _ := s.validate(active, items, base, arr[i], appendLocation(at, i), kw+"/items")
+				errs = append(errs, e...)
+			}
+			ev.allItems = true
+		}
+		if contains, ok := obj["contains"]; ok {
+			matches := 0
+			for i := range arr {
+				if e, _ := s.validate(active, contains, base, arr[i], appendLocation(at, i), kw+"/contains"); len(e) == 0 {
+					matches++
+				}
+			}
+			min, hasMin := jsonInt(obj["minContains"])
+			if !hasMin {
+				min = 1
+			}
+			if matches < min {
+				errs = append(errs, fail("contains", "%d items matched, expected at least %d", matches, min))
+			}
+			if max, ok := jsonInt(obj["maxContains"]); ok && matches > max {
+				errs = append(errs, fail("maxContains", "%d items matched, expected at most %d", matches, max))
+			}
+			if matches > 0 {
+				ev.allItems = ev.allItems || matches == len(arr)
+			}
+		}
+	}
+
+	if o, ok := inst.(map[string]interface{}); ok {
+		if m, ok := jsonInt(obj["maxProperties"]); ok && len(o) > m {
+			errs = append(errs, fail("maxProperties", "%d properties is more than %d", len(o), m))
+		}
+		if m, ok := jsonInt(obj["minProperties"]); ok && len(o) < m {
+			errs = append(errs, fail("minProperties", "%d properties is fewer than %d", len(o), m))
+		}
+		if req, ok := obj["required"].([]interface{}); ok {
+			for _, r := range req {
+				if k, ok := r.(string); ok {
+					if _, ok := o[k]; !ok {
+						errs = append(errs, fail("required", "missing required property %q", k))
+					}
+				}
+			}
+		}
+		if dr, ok := obj["dependentRequired"].(map[string]interface{}); ok {
+			for _, k := range sortedKeys(dr) {
+				if _, ok := o[k]; !ok {
+					continue
+				}
+				deps, _ := dr[k].([]interface{})
+				for _, d := range deps {
+					if dk, ok := d.(string); ok {
+						if _, ok := o[dk]; !ok {
+							errs = append(errs, fail("dependentRequired", "property %q requires %q", k, dk))
+						}
+					}
+				}
+			}
+		}
+		if pn, ok := obj["propertyNames"]; ok {
+			for _, k := range sortedKeys(o) {
+				e, _ := s.validate(active, pn, base, k, appendLocation(at, k), kw+"/propertyNames")
+				errs = append(errs, e...)
+			}
+		}
+
+		props, _ := obj["properties"].(map[string]interface{})
+		patternProps, _ := obj["patternProperties"].(map[string]interface{})
+		for _, k := range sortedKeys(o) {
+			matched := false
+			if ps, ok := props[k]; ok {
+				e, _ := s.validate(active, ps, base, o[k], appendLocation(at, k), kw+"/properties/"+k)
+				errs = append(errs, e...)
+				matched = true
+			}
+			for _, p := range sortedKeys(patternProps) {
+				re, err := s.pattern(p)
+				if err != nil {
+					errs = append(errs, fail("patternProperties", "%v", err))
+					continue
+				}
+				if re.MatchString(k) {
+					e, _ := s.validate(active, patternProps[p], base, o[k], appendLocation(at, k), kw+"/patternProperties/"+p)
+					errs = append(errs, e...)
+					matched = true
+				}
+			}
+			if ap, ok := obj["additionalProperties"]; ok && !matched {
+				e, _ := s.validate(active, ap, base, o[k], appendLocation(at, k), kw+"/additionalProperties")
+				errs = append(errs, e...)
+				matched = true
+			}
+			if matched {
+				ev.props[k] = true
+			}
+		}
+
+		if ds, ok := obj["dependentSchemas"].(map[string]interface{}); ok {
+			for _, k := range sortedKeys(ds) {
+				if _, ok := o[k]; ok {
+					sub(ds[k], kw+"/dependentSchemas/"+k)
+				}
+			}
+		}
+	}
+
+	if allOf, ok := obj["allOf"].([]interface{}); ok {
+		for i, child := range allOf {
+			sub(child, fmt.Sprintf("%s/allOf/%d", kw, i))
+		}
+	}
+
+	if anyOf, ok := obj["anyOf"].([]interface{}); ok {
+		var anyErrs []SchemaError
+		valid := false
+		for i, child := range anyOf {
+			e, cev := inPlace(child, fmt.Sprintf("%s/anyOf/%d", kw, i))
+			if len(e) == 0 {
+				valid = true
+				ev.merge(cev)
+			}
+			anyErrs = append(anyErrs, e...)
+		}
+		if !valid {
+			errs = append(errs, fail("anyOf", "no schema matched: %s", summarize(anyErrs)))
+		}
+	}
+
+	if oneOf, ok := obj["oneOf"].([]interface{}); ok {
+		var oneErrs []SchemaError
+		var valid []int
+		for i, child := range oneOf {
+			e, cev := inPlace(child, fmt.Sprintf("%s/oneOf/%d", kw, i))
+			if len(e) == 0 {
+				valid = append(valid, i)
+				ev.merge(cev)
+			}
+			oneErrs = append(oneErrs, e...)
+		}
+		switch len(valid) {
+		case 1:
+		case 0:
+			errs = append(errs, fail("oneOf", "no schema matched: %s", summarize(oneErrs)))
+		default:
+			errs = append(errs, fail("oneOf", "schemas %v all matched, expected only one", valid))
+		}
+	}
+
+	if not, ok := obj["not"]; ok {
+		if e, _ := inPlace(not, kw+"/not"); len(e) == 0 {
+			errs = append(errs, fail("not", "value must not match the schema"))
+		}
+	}
+
+	if cond, ok := obj["if"]; ok {
+		e, cev := inPlace(cond, kw+"/if")
+		if len(e) == 0 {
+			ev.merge(cev)
+			if then, ok := obj["then"]; ok {
+				sub(then, kw+"/then")
+			}
+		} else if els, ok := obj["else"]; ok {
+			sub(els, kw+"/else")
+		}
+	}
+
+	if arr, ok := inst.([]interface{}); ok {
+		if ui, ok := obj["unevaluatedItems"]; ok && !ev.allItems {
+			for i := ev.items; i < len(arr); i++ {
+				e, _ := s.validate(active, ui, base, arr[i], appendLocation(at, i), kw+"/unevaluatedItems")
+				errs = append(errs, e...)
+			}
+			ev.allItems = true
+		}
+	}
+
+	if o, ok := inst.(map[string]interface{}); ok {
+		if up, ok := obj["unevaluatedProperties"]; ok {
+			for _, k := range sortedKeys(o) {
+				if ev.props[k] {
+					continue
+				}
+				e, _ := s.validate(active, up, base, o[k], appendLocation(at, k), kw+"/unevaluatedProperties")
+				errs = append(errs, e...)
+				ev.props[k] = true
+			}
+		}
+	}
+
+	return errs, ev
+}
+
+func summarize(errs []SchemaError) string {
+	var parts []string
+	for _, e := range errs {
+		parts = append(parts, e.Error())
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func jsonType(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number, float64:
+		if r, ok := jsonRat(n); ok && r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonTypeIs(v interface{}, typ string) bool {
+	t := jsonType(v)
+
+	return t == typ || (typ == "number" && t == "integer")
+}
+
+func jsonRat(v interface{}) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(n))
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(n) == nil {
+			return nil, false
+		}
+		return r, true
+	}
+
+	return nil, false
+}
+
+func jsonInt(v interface{}) (int, bool) {
+	r, ok := jsonRat(v)
+	if !ok || !r.IsInt() {
+		return 0, false
+	}
+
+	return int(r.Num().Int64()), true
+}
+
+// jsonEqual compares decoded JSON values, with numbers compared by value
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if o, ok := bv[k]; !ok || !jsonEqual(v, o) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number, float64:
+		ar, aok := jsonRat(a)
+		br, bok := jsonRat(b)
+		return aok && bok && ar.Cmp(br) == 0
+	default:
+		return a == b
+	}
+}
+
+// BodyMatchesSchema verifies that every response body is valid against a JSON
+// Schema. Unlike the other assertions, this checks every response rather than
+// stopping at the first; the error lists each violation, per server. This
+// catches responses that are the same, but equally wrong.
+func (r Responses) BodyMatchesSchema(s *Schema) (err error) {
+	defer r.reproducible(&err)
+
+	var failures []string
+
+	for _, resp := range r {
+		prefix := fmt.Sprintf("(%s)%s", resp.Request.Method, resp.Request.URL)
+
+		errs, err := s.ValidateJSON(resp.Body)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: Body was not JSON: %v", prefix, err))
+			continue
+		}
+
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].InstancePath < errs[j].InstancePath })
+		for _, e := range errs {
+			failures = append(failures, fmt.Sprintf("%s: %v", prefix, e))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("schema violations:\n%s", strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
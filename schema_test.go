@@ -0,0 +1,245 @@
+package congruent
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://example.com/generate.json",
+  "type": "object",
+  "required": ["ok", "result"],
+  "properties": {
+    "ok": {"const": true},
+    "result": {
+      "type": "array",
+      "items": {"$ref": "#/$defs/word"},
+      "minItems": 1,
+      "uniqueItems": true
+    },
+    "candidate-count": {"type": "integer", "minimum": 0, "multipleOf": 2},
+    "mode": {"enum": ["short", "long"]},
+    "id": {"$ref": "#identifier"}
+  },
+  "unevaluatedProperties": false,
+  "$defs": {
+    "word": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8},
+    "id": {"$anchor": "identifier", "oneOf": [{"type": "string"}, {"type": "integer"}]}
+  }
+}`
+
+func schemaErrors(t *testing.T, s *Schema, doc string) []SchemaError {
+	errs, err := s.ValidateJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return errs
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := `{"ok":true,"result":["alpha","beta"],"candidate-count":70806,"mode":"short","id":3}`
+	if errs := schemaErrors(t, s, valid); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	// 1.0 counts as an integer in JSON Schema
+	if errs := schemaErrors(t, s, `{"ok":true,"result":["a"],"candidate-count":2.0}`); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	cases := []struct {
+		doc     string
+		path    string
+		keyword string
+	}{
+		{`{"result":["a"]}`, "$", "required"},
+		{`{"ok":false,"result":["a"]}`, "$.ok", "const"},
+		{`{"ok":true,"result":[]}`, "$.result", "minItems"},
+		{`{"ok":true,"result":["a","a"]}`, "$.result", "uniqueItems"},
+		{`{"ok":true,"result":["a","B"]}`, "$.result[1]", "pattern"},
+		{`{"ok":true,"result":["abcdefghi"]}`, "$.result[0]", "maxLength"},
+		{`{"ok":true,"result":[1]}`, "$.result[0]", "type"},
+		{`{"ok":true,"result":["a"],"candidate-count":3}`, "$.candidate-count", "multipleOf"},
+		{`{"ok":true,"result":["a"],"candidate-count":-2}`, "$.candidate-count", "minimum"},
+		{`{"ok":true,"result":["a"],"candidate-count":"2"}`, "$.candidate-count", "type"},
+		{`{"ok":true,"result":["a"],"mode":"medium"}`, "$.mode", "enum"},
+		{`{"ok":true,"result":["a"],"id":true}`, "$.id", "oneOf"},
+		{`{"ok":true,"result":["a"],"extra":1}`, "$.extra", "false"},
+	}
+
+	for _, c := range cases {
+		errs := schemaErrors(t, s, c.doc)
+		if len(errs) != 1 {
+			t.Errorf("%s: expected 1 error, got %v", c.doc, errs)
+			continue
+		}
+		if errs[0].InstancePath != c.path || errs[0].Keyword != c.keyword {
+			t.Errorf("%s: expected %s at %s, got %v", c.doc, c.keyword, c.path, errs[0])
+		}
+	}
+}
+
+func TestSchemaApplicators(t *testing.T) {
+	s, err := ParseSchema([]byte(`{
+	  "type": "object",
+	  "allOf": [{"properties": {"a": {"type": "integer"}}}],
+	  "if": {"properties": {"kind": {"const": "b"}}, "required": ["kind"]},
+	  "then": {"required": ["b"], "properties": {"b": true}},
+	  "else": {"not": {"required": ["b"]}},
+	  "properties": {"kind": true},
+	  "dependentRequired": {"c": ["a"]},
+	  "unevaluatedProperties": false,
+	  "patternProperties": {"^c$": {"type": "string"}},
+	  "propertyNames": {"maxLength": 4}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, doc := range []string{`{"a":1}`, `{"kind":"b","b":2}`, `{"a":1,"c":"x"}`} {
+		if errs := schemaErrors(t, s, doc); len(errs) != 0 {
+			t.Errorf("%s: expected no errors, got %v", doc, errs)
+		}
+	}
+
+	for _, doc := range []string{`{"kind":"b"}`, `{"b":2}`, `{"c":"x"}`, `{"a":1.5}`, `{"toolong":1}`} {
+		if errs := schemaErrors(t, s, doc); len(errs) == 0 {
+			t.Errorf("%s: Expected error, but got none!", doc)
+		}
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "congruent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(p, []byte(`{"$defs":{"n":{"type":"number"}},"$ref":"#/$defs/n"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadSchema(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := schemaErrors(t, s, `"x"`); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+
+	s, err = ParseSchema([]byte(`{"$ref":"other.json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := schemaErrors(t, s, `1`); len(errs) != 1 || !strings.Contains(errs[0].Message, "unresolvable") {
+		t.Errorf("expected an unresolvable reference, got %v", errs)
+	}
+}
+
+func TestSchemaRelativeIDs(t *testing.T) {
+	s, err := ParseSchema([]byte(`{
+	  "$id": "schemas/root.json",
+	  "$defs": {
+	    "n": {"type": "number"},
+	    "item": {
+	      "$id": "item.json",
+	      "properties": {"id": {"$ref": "#/$defs/id"}},
+	      "$defs": {"id": {"type": "integer"}}
+	    },
+	    "leaf": {"$id": "sub/leaf.json", "$anchor": "leaf", "type": "string"}
+	  },
+	  "properties": {
+	    "a": {"$ref": "#/$defs/n"},
+	    "b": {"$ref": "item.json"},
+	    "c": {"$ref": "sub/leaf.json"},
+	    "d": {"$ref": "item.json#/$defs/id"},
+	    "e": {"$ref": "sub/leaf.json#leaf"}
+	  }
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := schemaErrors(t, s, `{"a":1.5,"b":{"id":1},"c":"x","d":2,"e":"y"}`); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	errs := schemaErrors(t, s, `{"a":"x","b":{"id":1.5},"c":1,"d":"x","e":1}`)
+	if len(errs) != 5 {
+		t.Fatalf("expected 5 errors, got %v", errs)
+	}
+	for _, e := range errs {
+		if e.Keyword != "type" {
+			t.Errorf("expected a type error, got %v", e)
+		}
+	}
+}
+
+func TestSchemaRecursion(t *testing.T) {
+	s, err := ParseSchema([]byte(`{"type":"object","properties":{"next":{"$ref":"#"},"n":{"type":"integer"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := schemaErrors(t, s, `{"next":{"next":{"n":1}}}`); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if errs := schemaErrors(t, s, `{"next":{"next":{"n":"x"}}}`); len(errs) != 1 || errs[0].InstancePath != "$.next.next.n" {
+		t.Errorf("expected 1 error at $.next.next.n, got %v", errs)
+	}
+
+	// references which never move into the value must stop
+	for _, schema := range []string{`{"$ref":"#"}`, `{"anyOf":[{"$ref":"#/$defs/a"}],"$defs":{"a":{"$ref":"#"}}}`} {
+		s, err := ParseSchema([]byte(schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := schemaErrors(t, s, `1`); len(errs) == 0 {
+			t.Errorf("%s: Expected error, but got none!", schema)
+		}
+	}
+}
+
+func TestBodyMatchesSchema(t *testing.T) {
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gu, _ := url.Parse("http://good/")
+	bu, _ := url.Parse("http://bad/")
+	responses := Responses{
+		&Response{Request: &http.Request{Method: "GET", URL: gu}, Body: []byte(`{"ok":true,"result":["a"]}`)},
+		&Response{Request: &http.Request{Method: "GET", URL: bu}, Body: []byte(`{"ok":true,"result":[1]}`)},
+		&Response{Request: &http.Request{Method: "GET", URL: bu}, Body: []byte(`not json`)},
+	}
+
+	err = responses.BodyMatchesSchema(s)
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	// the failures, without the curl commands for every server
+	msg := errors.Unwrap(err).Error()
+	if strings.Contains(msg, "good") {
+		t.Errorf("expected only the bad servers to be reported, got: %v", msg)
+	}
+	if !strings.Contains(msg, "(GET)http://bad/: $.result[0]") || !strings.Contains(msg, "type") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+	if !strings.Contains(msg, "not JSON") {
+		t.Errorf("Did not get expected error string, got: %v", msg)
+	}
+}
@@ -0,0 +1,401 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultShrinkAttempts is the most requests Shrink will make to each server
+// while minimizing a request
+const DefaultShrinkAttempts = 1000
+
+// shrinker holds the parts of a request being minimized; each can be dropped
+// or shortened independently of the others
+type shrinker struct {
+	req      *Request
+	path     string
+	query    [][2]string
+	headers  [][2]string
+	body     interface{}
+	jsonBody bool
+
+	servers    Servers
+	assertions []Assertion
+	attempts   int
+}
+
+// Shrink minimizes a request on which the servers disagree, by delta debugging:
+// it repeatedly drops headers, query parameters and JSON body fields, and
+// shortens strings and arrays, keeping each change only if the servers still
+// disagree. With no assertions, the servers must agree on status and body
+// content. It returns an error if the servers agree on the original request.
+func Shrink(s Servers, req *Request, assertions ...Assertion) (*Request, error) {
+	if len(assertions) == 0 {
+		assertions = defaultAssertions()
+	}
+
+	sh := &shrinker{req: req, servers: s, assertions: assertions}
+	sh.path = req.Path
+	if i := strings.Index(req.Path, "?"); i >= 0 {
+		sh.path = req.Path[:i]
+		for _, pair := range strings.Split(req.Path[i+1:], "&") {
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			k, _ := url.QueryUnescape(kv[0])
+			v := ""
+			if len(kv) > 1 {
+				v, _ = url.QueryUnescape(kv[1])
+			}
+			sh.query = append(sh.query, [2]string{k, v})
+		}
+	}
+	if req.Headers != nil {
+		for _, k := range sortedHeaderKeys(*req.Headers) {
+			for _, v := range (*req.Headers)[k] {
+				sh.headers = append(sh.headers, [2]string{k, v})
+			}
+		}
+	}
+	sh.body = req.Body
+
+	if err := differ(s, req, assertions); err == nil {
+		return nil, fmt.Errorf("(%s)%s: servers agree, nothing to shrink", req.Method, req.Path)
+	}
+
+	// bodies are only shrunk structurally if re-encoding them doesn't change
+	// the outcome
+	if sh.decodeBody() && !sh.fails() {
+		sh.body, sh.jsonBody = req.Body, false
+	}
+
+	sh.headers = sh.shrinkPairs(sh.headers, func(p [][2]string) { sh.headers = p })
+	sh.query = sh.shrinkPairs(sh.query, func(p [][2]string) { sh.query = p })
+
+	if sh.jsonBody {
+		sh.shrinkValue(sh.body, func(v interface{}) { sh.body = v })
+	} else if b, ok := sh.body.(string); ok {
+		sh.shrinkString(b, func(s string) { sh.body = s })
+	}
+
+	return sh.request(), nil
+}
+
+// decodeBody swaps the body for its decoded JSON, if it is an object or array
+func (sh *shrinker) decodeBody() bool {
+	var b []byte
+	switch body := sh.body.(type) {
+	case nil:
+		return false
+	case string:
+		b = []byte(body)
+	default:
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return false
+		}
+	}
+
+	var v interface{}
+	if err := unmarshalNumbers(b, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		sh.body, sh.jsonBody = v, true
+		return true
+	}
+
+	return false
+}
+
+// request builds a Request from the current state
+func (sh *shrinker) request() *Request {
+	r := *sh.req
+
+	r.Path = sh.path
+	if len(sh.query) > 0 {
+		var pairs []string
+		for _, kv := range sh.query {
+			pairs = append(pairs, url.QueryEscape(kv[0])+"="+url.QueryEscape(kv[1]))
+		}
+		r.Path += "?" + strings.Join(pairs, "&")
+	}
+
+	if sh.req.Headers != nil {
+		h := http.Header{}
+		for _, kv := range sh.headers {
+			h.Add(kv[0], kv[1])
+		}
+		r.Headers = &h
+	}
+
+	r.Body = sh.body
+	if sh.jsonBody {
+		b, _ := json.Marshal(sh.body)
+		r.Body = string(b)
+	}
+
+	return &r
+}
+
+// fails reports whether the servers still disagree on the current state
+func (sh *shrinker) fails() bool {
+	if sh.attempts >= DefaultShrinkAttempts {
+		return false
+	}
+	sh.attempts++
+
+	return differ(sh.servers, sh.request(), sh.assertions) != nil
+}
+
+// shrinkPairs minimizes a list of key-value pairs, then shortens each value
+func (sh *shrinker) shrinkPairs(pairs [][2]string, set func([][2]string)) [][2]string {
+	keep := ddmin(len(pairs), func(keep []int) bool {
+		subset := make([][2]string, len(keep))
+		for i, k := range keep {
+			subset[i] = pairs[k]
+		}
+		set(subset)
+		return sh.fails()
+	})
+
+	kept := make([][2]string, len(keep))
+	for i, k := range keep {
+		kept[i] = pairs[k]
+	}
+	set(kept)
+
+	for i := range kept {
+		sh.shrinkString(kept[i][1], func(s string) { kept[i][1] = s })
+	}
+
+	return kept
+}
+
+// shrinkString minimizes the characters of a string
+func (sh *shrinker) shrinkString(s string, set func(string)) {
+	runes := []rune(s)
+	subset := func(keep []int) string {
+		r := make([]rune, len(keep))
+		for i, k := range keep {
+			r[i] = runes[k]
+		}
+		return string(r)
+	}
+
+	keep := ddmin(len(runes), func(keep []int) bool {
+		set(subset(keep))
+		return sh.fails()
+	})
+	set(subset(keep))
+}
+
+// shrinkValue minimizes a decoded JSON value in place; set replaces it in its
+// parent
+func (sh *shrinker) shrinkValue(v interface{}, set func(interface{})) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(value)
+		subset := func(keep []int) map[string]interface{} {
+			m := make(map[string]interface{}, len(keep))
+			for _, k := range keep {
+				m[keys[k]] = value[keys[k]]
+			}
+			return m
+		}
+
+		keep := ddmin(len(keys), func(keep []int) bool {
+			set(subset(keep))
+			return sh.fails()
+		})
+		m := subset(keep)
+		set(m)
+
+		for _, k := range sortedKeys(m) {
+			sh.shrinkValue(m[k], func(v interface{}) { m[k] = v })
+		}
+	case []interface{}:
+		subset := func(keep []int) []interface{} {
+			a := make([]interface{}, len(keep))
+			for i, k := range keep {
+				a[i] = value[k]
+			}
+			return a
+		}
+
+		keep := ddmin(len(value), func(keep []int) bool {
+			set(subset(keep))
+			return sh.fails()
+		})
+		a := subset(keep)
+		set(a)
+
+		for i := range a {
+			sh.shrinkValue(a[i], func(v interface{}) { a[i] = v })
+		}
+	case string:
+		sh.shrinkString(value, func(s string) { set(s) })
+	}
+}
+
+// ddmin finds a small subset of n items for which fails holds, given that it
+// holds for all of them. It tries removing ever smaller chunks of the items,
+// keeping each removal which still fails; the result is the indexes kept.
+func ddmin(n int, fails func(keep []int) bool) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	if n == 0 || fails(nil) {
+		return nil
+	}
+
+	granularity := 2
+	for len(items) >= 2 {
+		if granularity > len(items) {
+			granularity = len(items)
+		}
+		chunk := (len(items) + granularity - 1) / granularity
+
+		reduced := false
+		for start := 0; start < len(items); start += chunk {
+			end := start + chunk
+			if end > len(items) {
+				end = len(items)
+			}
+
+			complement := append(append([]int{}, items[:start]...), items[end:]...)
+			if fails(complement) {
+				items = complement
+				if granularity > 2 {
+					granularity--
+				}
+				reduced = true
+				break
+			}
+		}
+
+		if !reduced {
+			if granularity >= len(items) {
+				break
+			}
+			granularity *= 2
+		}
+	}
+
+	return items
+}
+
+// Literal formats the request as a Go composite literal, ready to paste into a
+// test; every field which is set is included. A body which isn't a string is
+// written as its JSON encoding, which is sent the same way.
+func (r Request) Literal() string {
+	var fields []string
+	if r.Name != "" {
+		fields = append(fields, "Name: "+strconv.Quote(r.Name))
+	}
+	if r.Method != "" {
+		fields = append(fields, "Method: "+strconv.Quote(r.Method))
+	}
+	if r.Path != "" {
+		fields = append(fields, "Path: "+strconv.Quote(r.Path))
+	}
+
+	if r.Headers != nil {
+		var entries []string
+		for _, k := range sortedHeaderKeys(*r.Headers) {
+			var values []string
+			for _, v := range (*r.Headers)[k] {
+				values = append(values, strconv.Quote(v))
+			}
+			entries = append(entries, fmt.Sprintf("%q: {%s}", k, strings.Join(values, ", ")))
+		}
+		fields = append(fields, fmt.Sprintf("Headers: &http.Header{%s}", strings.Join(entries, ", ")))
+	}
+
+	switch b := r.Body.(type) {
+	case nil:
+	case string:
+		fields = append(fields, "Body: "+goStringLiteral(b))
+	default:
+		if encoded, err := json.Marshal(b); err == nil {
+			fields = append(fields, "Body: "+goStringLiteral(string(encoded)))
+		} else {
+			fields = append(fields, fmt.Sprintf("Body: %#v", b))
+		}
+	}
+
+	switch r.Redirect {
+	case RedirectFollow:
+	case RedirectNone:
+		fields = append(fields, "Redirect: congruent.RedirectNone")
+	case RedirectRecord:
+		fields = append(fields, "Redirect: congruent.RedirectRecord")
+	default:
+		fields = append(fields, fmt.Sprintf("Redirect: congruent.RedirectMode(%d)", r.Redirect))
+	}
+
+	if p := r.Retry; p != nil {
+		var retry []string
+		if p.Attempts != 0 {
+			retry = append(retry, fmt.Sprintf("Attempts: %d", p.Attempts))
+		}
+		if p.Backoff != 0 {
+			retry = append(retry, "Backoff: "+durationLiteral(p.Backoff))
+		}
+		if p.MaxBackoff != 0 {
+			retry = append(retry, "MaxBackoff: "+durationLiteral(p.MaxBackoff))
+		}
+		if p.Statuses != nil {
+			var statuses []string
+			for _, status := range p.Statuses {
+				statuses = append(statuses, strconv.Itoa(status))
+			}
+			retry = append(retry, fmt.Sprintf("Statuses: []int{%s}", strings.Join(statuses, ", ")))
+		}
+		fields = append(fields, fmt.Sprintf("Retry: &congruent.RetryPolicy{%s}", strings.Join(retry, ", ")))
+	}
+
+	return "&congruent.Request{" + strings.Join(fields, ", ") + "}"
+}
+
+// durationLiteral writes a duration in the largest unit which divides it, like
+// `100 * time.Millisecond`
+func durationLiteral(d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, u := range units {
+		if d%u.d == 0 {
+			if d == u.d {
+				return u.name
+			}
+			return fmt.Sprintf("%d * %s", d/u.d, u.name)
+		}
+	}
+
+	return strconv.FormatInt(int64(d), 10)
+}
+
+// goStringLiteral prefers a raw string literal, which keeps JSON readable
+func goStringLiteral(s string) string {
+	if strings.ContainsAny(s, "`\r") || !strconv.CanBackquote(s) {
+		return strconv.Quote(s)
+	}
+
+	return "`" + s + "`"
+}
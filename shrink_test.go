@@ -0,0 +1,116 @@
+package congruent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDDMin(t *testing.T) {
+	// fails whenever both 3 and 7 are kept
+	keep := ddmin(10, func(keep []int) bool {
+		found := 0
+		for _, k := range keep {
+			if k == 3 || k == 7 {
+				found++
+			}
+		}
+		return found == 2
+	})
+
+	if fmt.Sprint(keep) != "[3 7]" {
+		t.Errorf("expected [3 7], got %v", keep)
+	}
+
+	if keep := ddmin(4, func([]int) bool { return true }); len(keep) != 0 {
+		t.Errorf("expected nothing to be kept, got %v", keep)
+	}
+}
+
+func TestShrink(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true}`)
+	}
+	ts0 := httptest.NewServer(http.HandlerFunc(ok))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Items []json.Number }
+		json.NewDecoder(r.Body).Decode(&body)
+
+		thirteen := false
+		for _, n := range body.Items {
+			thirteen = thirteen || n == "13"
+		}
+		if thirteen && strings.Contains(r.URL.Query().Get("q"), "!") {
+			w.WriteHeader(500)
+			return
+		}
+		ok(w, r)
+	}))
+	defer ts1.Close()
+
+	servers := Servers{NewServer(ts0.URL+"/", nil), NewServer(ts1.URL+"/", nil)}
+
+	headers := http.Header{"X-One": {"1"}, "X-Two": {"2"}}
+	req := NewRequest("POST", "words?page=2&q=hello%21world&sort=asc", &headers, map[string]interface{}{
+		"items": []int{1, 5, 13, 21},
+		"name":  "a long name",
+		"meta":  map[string]interface{}{"tags": []string{"x", "y"}},
+	})
+
+	shrunk, err := Shrink(servers, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shrunk.Path != "words?q=%21" {
+		t.Errorf("unexpected path %s", shrunk.Path)
+	}
+	if len(*shrunk.Headers) != 0 {
+		t.Errorf("expected no headers, got %v", *shrunk.Headers)
+	}
+	if shrunk.Body != `{"items":[13]}` {
+		t.Errorf("unexpected body %v", shrunk.Body)
+	}
+
+	expected := "&congruent.Request{Method: \"POST\", Path: \"words?q=%21\", Headers: &http.Header{}, Body: `{\"items\":[13]}`}"
+	if s := shrunk.Literal(); s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+
+	// the original is left alone
+	if req.Path != "words?page=2&q=hello%21world&sort=asc" || len(headers) != 2 {
+		t.Errorf("expected the original request to be unchanged, got %s", req.Literal())
+	}
+
+	if _, err := Shrink(servers, NewRequest("GET", "words", nil, "")); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestRequestLiteral(t *testing.T) {
+	r := NewRequest("PUT", "/words/1", &http.Header{"X-Test": {"a", "b"}}, map[string]int{"n": 1})
+	r.Name = "update"
+	r.Redirect = RedirectRecord
+	r.Retry = &RetryPolicy{Attempts: 3, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Statuses: []int{502, 503}}
+
+	expected := "&congruent.Request{Name: \"update\", Method: \"PUT\", Path: \"/words/1\", " +
+		"Headers: &http.Header{\"X-Test\": {\"a\", \"b\"}}, Body: `{\"n\":1}`, " +
+		"Redirect: congruent.RedirectRecord, " +
+		"Retry: &congruent.RetryPolicy{Attempts: 3, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Statuses: []int{502, 503}}}"
+	if s := r.Literal(); s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+
+	// the zero values are left out, and formatting with %#v is unchanged
+	if s := (Request{Method: "GET"}).Literal(); s != `&congruent.Request{Method: "GET"}` {
+		t.Errorf("unexpected literal %s", s)
+	}
+	if s := fmt.Sprintf("%#v", Request{Method: "GET"}); !strings.HasPrefix(s, "congruent.Request{Name:") {
+		t.Errorf("unexpected formatting %s", s)
+	}
+}
@@ -0,0 +1,202 @@
+package congruent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusOption changes which status codes CompareStatus and StatusEquivalent
+// accept as equivalent
+type StatusOption func(*statusConfig)
+
+type statusConfig struct {
+	classes  bool
+	mappings map[[2]int]bool
+}
+
+// StatusClasses accepts any two status codes of the same class, so that 200
+// and 204 are equivalent, being both `2xx`
+func StatusClasses() StatusOption {
+	return func(c *statusConfig) {
+		c.classes = true
+	}
+}
+
+// MapStatus accepts the candidate status where the baseline has another, like
+// a 422 where the baseline returned a 400. Mappings only apply one way.
+func MapStatus(baseline, candidate int) StatusOption {
+	return func(c *statusConfig) {
+		c.mappings[[2]int{baseline, candidate}] = true
+	}
+}
+
+// StatusOutcome is how a candidate's status compared to the baseline's
+type StatusOutcome int
+
+const (
+	// StatusExact is the same status as the baseline
+	StatusExact StatusOutcome = iota
+	// StatusSameClass is a different status, of the same class, accepted by
+	// StatusClasses
+	StatusSameClass
+	// StatusMapped is a different status, accepted by MapStatus
+	StatusMapped
+	// StatusMismatch is a different status which wasn't accepted
+	StatusMismatch
+)
+
+func (o StatusOutcome) String() string {
+	switch o {
+	case StatusExact:
+		return "exact"
+	case StatusSameClass:
+		return "same class"
+	case StatusMapped:
+		return "accepted mapping"
+	case StatusMismatch:
+		return "mismatch"
+	}
+
+	return fmt.Sprintf("StatusOutcome(%d)", int(o))
+}
+
+// StatusComparison is the comparison of one candidate response's status with
+// the baseline's
+type StatusComparison struct {
+	Response  *Response
+	Baseline  int
+	Candidate int
+	Outcome   StatusOutcome
+}
+
+func (c StatusComparison) String() string {
+	return fmt.Sprintf("(%s)%s: %s, status was %d, baseline %d",
+		c.Response.Request.Method, c.Response.Request.URL, c.Outcome, c.Candidate, c.Baseline)
+}
+
+// StatusReport lists the status comparisons of every candidate response
+type StatusReport []StatusComparison
+
+// CompareStatus compares the status of every response to the first, which is
+// taken as the baseline, accepting the differences that the options allow
+func (r Responses) CompareStatus(opts ...StatusOption) StatusReport {
+	c := &statusConfig{mappings: map[[2]int]bool{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var report StatusReport
+	for i := 1; i < len(r); i++ {
+		baseline, candidate := r[0].StatusCode, r[i].StatusCode
+
+		outcome := StatusMismatch
+		switch {
+		case baseline == candidate:
+			outcome = StatusExact
+		case c.mappings[[2]int{baseline, candidate}]:
+			outcome = StatusMapped
+		case c.classes && baseline/100 == candidate/100:
+			outcome = StatusSameClass
+		}
+
+		report = append(report, StatusComparison{
+			Response:  r[i],
+			Baseline:  baseline,
+			Candidate: candidate,
+			Outcome:   outcome,
+		})
+	}
+
+	return report
+}
+
+// Accepted lists the comparisons which differed, but were accepted
+func (sr StatusReport) Accepted() StatusReport {
+	return sr.filter(func(o StatusOutcome) bool { return o == StatusSameClass || o == StatusMapped })
+}
+
+// Mismatches lists the comparisons which differed and weren't accepted
+func (sr StatusReport) Mismatches() StatusReport {
+	return sr.filter(func(o StatusOutcome) bool { return o == StatusMismatch })
+}
+
+func (sr StatusReport) filter(keep func(StatusOutcome) bool) StatusReport {
+	var kept StatusReport
+	for _, c := range sr {
+		if keep(c.Outcome) {
+			kept = append(kept, c)
+		}
+	}
+
+	return kept
+}
+
+// String lists the accepted differences apart from the real mismatches
+func (sr StatusReport) String() string {
+	var b strings.Builder
+
+	for _, section := range []struct {
+		title string
+		list  StatusReport
+	}{
+		{"Accepted", sr.Accepted()},
+		{"Mismatched", sr.Mismatches()},
+	} {
+		fmt.Fprintf(&b, "%s: %d\n", section.title, len(section.list))
+		for _, c := range section.list {
+			fmt.Fprintf(&b, "  %s\n", c)
+		}
+	}
+
+	return b.String()
+}
+
+// Err returns an error describing the mismatches, or nil if there were none
+func (sr StatusReport) Err() error {
+	mismatches := sr.Mismatches()
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	var lines []string
+	for _, c := range mismatches {
+		lines = append(lines, c.String())
+	}
+
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// StatusEquivalent verifies that the status of every response is equivalent to
+// the first's, allowing for the differences the options accept; returns an
+// error listing every mismatch, if not.
+func (r Responses) StatusEquivalent(opts ...StatusOption) (err error) {
+	defer r.reproducible(&err)
+
+	return r.CompareStatus(opts...).Err()
+}
+
+// StatusClassEqual verifies that all responses have a status in a class, given
+// as `2xx`; returns an error for the first mismatch, if not.
+func (r Responses) StatusClassEqual(class string) (err error) {
+	defer r.reproducible(&err)
+
+	class = strings.ToLower(class)
+	n, err := strconv.Atoi(strings.TrimSuffix(class, "xx"))
+	if err != nil || !strings.HasSuffix(class, "xx") || n < 1 || n > 5 {
+		return fmt.Errorf("invalid status class %q", class)
+	}
+
+	for _, resp := range r {
+		if resp.StatusCode/100 != n {
+			return fmt.Errorf(
+				"(%s)%s: Status was %d, expected %s",
+				resp.Request.Method,
+				resp.Request.URL,
+				resp.StatusCode,
+				class)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package congruent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareStatus(t *testing.T) {
+	responses := mockStatuses(200, 200, 204, 201)
+
+	if err := responses.StatusEquivalent(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+	if err := responses.StatusEquivalent(StatusClasses()); err != nil {
+		t.Error(err)
+	}
+
+	report := responses.CompareStatus(MapStatus(200, 204))
+	outcomes := []StatusOutcome{StatusExact, StatusMapped, StatusMismatch}
+	if len(report) != 3 {
+		t.Fatalf("expected 3 comparisons, got %d", len(report))
+	}
+	for i, o := range outcomes {
+		if report[i].Outcome != o {
+			t.Errorf("comparison %d: expected %s, got %s", i, o, report[i].Outcome)
+		}
+	}
+
+	if l := len(report.Accepted()); l != 1 {
+		t.Errorf("expected 1 accepted difference, got %d", l)
+	}
+	err := report.Err()
+	if err == nil {
+		t.Fatal("Expected error, but got none!")
+	}
+	if err.Error() != "(GET)http://server3/: mismatch, status was 201, baseline 200" {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	expected := "Accepted: 1\n" +
+		"  (GET)http://server2/: accepted mapping, status was 204, baseline 200\n" +
+		"Mismatched: 1\n" +
+		"  (GET)http://server3/: mismatch, status was 201, baseline 200\n"
+	if s := report.String(); s != expected {
+		t.Errorf("expected report:\n%s\ngot:\n%s", expected, s)
+	}
+
+	// mappings only apply one way
+	if err := mockStatuses(422, 400).StatusEquivalent(MapStatus(400, 422)); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+	if err := mockStatuses(400, 422).StatusEquivalent(MapStatus(400, 422)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatusClassEqual(t *testing.T) {
+	if err := mockStatuses(200, 204).StatusClassEqual("2xx"); err != nil {
+		t.Error(err)
+	}
+	if err := mockStatuses(200, 404).StatusClassEqual("2XX"); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "Status was 404, expected 2xx") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+	for _, class := range []string{"2", "xx", "9xx", "200"} {
+		if err := mockStatuses(200).StatusClassEqual(class); err == nil {
+			t.Errorf("%s: Expected error, but got none!", class)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package congruent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamConfig bounds how much of a streaming response is read from each
+// server. A zero value for either field means no bound.
+type StreamConfig struct {
+	MaxEvents int
+	Timeout   time.Duration
+}
+
+// Event is a single message read from a stream. Server-Sent Events fill in all
+// fields; for NDJSON and other line-delimited streams, only Data is set.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// StreamResponse represents a streaming response from a server. Complete is
+// false when reading stopped because of a StreamConfig bound rather than the
+// server ending the stream.
+type StreamResponse struct {
+	Request    *http.Request
+	Headers    *http.Header
+	StatusCode int
+	Events     []Event
+	Complete   bool
+}
+
+// StreamResponses is an array of StreamResponse pointers
+type StreamResponses []*StreamResponse
+
+// DoStream performs a Request and reads its response as a stream of events,
+// until the server closes it or a bound in the StreamConfig is reached.
+// Responses with a `text/event-stream` content type are parsed as Server-Sent
+// Events, and anything else as one event per non-empty line.
+func (r Request) DoStream(s *Server, c StreamConfig) (*StreamResponse, error) {
+	req, err := r.newHTTPRequest(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// compressed streams can't be decoded as they arrive, so don't ask for them
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), c.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	sr := &StreamResponse{
+		Request:    req,
+		Headers:    &resp.Header,
+		StatusCode: resp.StatusCode,
+	}
+
+	read := readLines
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "text/event-stream" {
+		read = readSSE
+	}
+
+	err = read(bufio.NewReader(resp.Body), func(e Event) bool {
+		sr.Events = append(sr.Events, e)
+		return c.MaxEvents <= 0 || len(sr.Events) < c.MaxEvents
+	})
+	switch {
+	case err == io.EOF:
+		sr.Complete = true
+	case err == errStreamStopped, errors.Is(err, context.DeadlineExceeded):
+	default:
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+// Stream makes a streaming Request against a list of servers, and returns the
+// events read from each, in the same order as the servers
+func (s Servers) Stream(r *Request, c StreamConfig) (StreamResponses, error) {
+	responses := make(StreamResponses, len(s))
+	err := s.each(func(i int, server *Server) (err error) {
+		responses[i], err = r.DoStream(server, c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
+
+// errStreamStopped is returned by a reader when its callback asks it to stop
+var errStreamStopped = errors.New("stream stopped")
+
+// readLines emits each non-empty line as an event, which covers NDJSON as well
+// as plain chunked text
+func readLines(r *bufio.Reader, emit func(Event) bool) error {
+	for {
+		line, err := r.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			if !emit(Event{Data: line}) {
+				return errStreamStopped
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readSSE parses Server-Sent Events as described by the WHATWG HTML spec;
+// comments and `retry` fields are discarded, and events without data are not
+// emitted.
+func readSSE(r *bufio.Reader, emit func(Event) bool) error {
+	var e Event
+	var data []string
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if len(data) > 0 {
+				e.Data = strings.Join(data, "\n")
+				if !emit(e) {
+					return errStreamStopped
+				}
+			}
+			e, data = Event{ID: e.ID}, nil
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			e.Event = value
+		case "id":
+			e.ID = value
+		}
+	}
+}
+
+// EventsSame verifies that every server sent the same number of events, and
+// that each event's type, id and data were identical; returns an error for the
+// first mismatch, if not.
+func (r StreamResponses) EventsSame() error {
+	return r.eventsEqual(func(a, b string) (string, string, bool) {
+		return a, b, a == b
+	})
+}
+
+// EventsContentSame is as EventsSame, but compares the data of each event the
+// way BodyContentSame compares bodies, ignoring JSON formatting.
+func (r StreamResponses) EventsContentSame() error {
+	return r.eventsEqual(func(a, b string) (string, string, bool) {
+		return a, b, contentEqual([]byte(a), []byte(b))
+	})
+}
+
+func (r StreamResponses) eventsEqual(dataEqual func(a, b string) (string, string, bool)) error {
+	if len(r) < 2 {
+		return nil
+	}
+
+	for i, resp := range r[1:] {
+		prev := r[i]
+		method, url := resp.Request.Method, resp.Request.URL
+
+		if lp, lr := len(prev.Events), len(resp.Events); lp != lr {
+			return fmt.Errorf(
+				"(%s)%s: Received %d events, expected %d", method, url, lr, lp)
+		}
+
+		for j, e := range resp.Events {
+			pe := prev.Events[j]
+			if e.Event != pe.Event {
+				return fmt.Errorf(
+					"(%s)%s: Expected event %d to have type %q, was %q",
+					method, url, j, pe.Event, e.Event)
+			}
+			if e.ID != pe.ID {
+				return fmt.Errorf(
+					"(%s)%s: Expected event %d to have id %q, was %q",
+					method, url, j, pe.ID, e.ID)
+			}
+			if a, b, ok := dataEqual(pe.Data, e.Data); !ok {
+				return fmt.Errorf(
+					"(%s)%s: event %d:\nExpected data:\n  %s\nReceived data: \n  %s",
+					method, url, j, cutBody([]byte(a)), cutBody([]byte(b)))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package congruent
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadSSE(t *testing.T) {
+	stream := ": comment\n" +
+		"event: greeting\nid: 1\ndata: hello\ndata:  world\n\n" +
+		"retry: 1000\n\n" +
+		"data: {\"a\":1}\r\n\r\n" +
+		"data: unterminated"
+
+	var events []Event
+	err := readSSE(bufio.NewReader(strings.NewReader(stream)), func(e Event) bool {
+		events = append(events, e)
+		return true
+	})
+	if err == nil {
+		t.Error("Expected EOF, but got none!")
+	}
+
+	expected := []Event{
+		{ID: "1", Event: "greeting", Data: "hello\n world"},
+		{ID: "1", Data: `{"a":1}`},
+	}
+	if le, lv := len(events), len(expected); le != lv {
+		t.Fatalf("expected %d events, got %d: %v", lv, le, events)
+	}
+	for i, e := range expected {
+		if events[i] != e {
+			t.Errorf("expected %v, got %v", e, events[i])
+		}
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	stream := "{\"a\":1}\n\n{\"a\":2}\r\n{\"a\":3}"
+
+	var events []Event
+	err := readLines(bufio.NewReader(strings.NewReader(stream)), func(e Event) bool {
+		events = append(events, e)
+		return len(events) < 2
+	})
+	if err != errStreamStopped {
+		t.Errorf("expected stream to be stopped, got %v", err)
+	}
+	if len(events) != 2 || events[1].Data != `{"a":2}` {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func sseHandler(events []string, hold bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\n\n", e)
+			w.(http.Flusher).Flush()
+		}
+		if hold {
+			<-r.Context().Done()
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	ts0 := httptest.NewServer(sseHandler([]string{`{"n":1}`, `{"n":2}`}, false))
+	defer ts0.Close()
+	ts1 := httptest.NewServer(sseHandler([]string{`{ "n": 1.0 }`, `{ "n": 2e0 }`}, false))
+	defer ts1.Close()
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"n\":1}\n{\"n\":3}\n")
+	}))
+	defer ts2.Close()
+
+	servers := Servers{NewServer(ts0.URL, nil), NewServer(ts1.URL, nil)}
+	request := NewRequest("GET", "/", nil, nil)
+
+	responses, err := servers.Stream(request, StreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resp := range responses {
+		if !resp.Complete {
+			t.Errorf("expected stream from %s to be complete", resp.Request.URL)
+		}
+	}
+	if err := responses.EventsContentSame(); err != nil {
+		t.Error(err)
+	}
+	if err := responses.EventsSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+
+	servers = Servers{NewServer(ts0.URL, nil), NewServer(ts2.URL, nil)}
+	responses, err = servers.Stream(request, StreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.EventsContentSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "event 1") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestStreamBounds(t *testing.T) {
+	ts := httptest.NewServer(sseHandler([]string{"a", "b", "c"}, true))
+	defer ts.Close()
+
+	request := NewRequest("GET", "/", nil, nil)
+	server := NewServer(ts.URL, nil)
+
+	resp, err := request.DoStream(server, StreamConfig{MaxEvents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 2 || resp.Complete {
+		t.Errorf("expected 2 events from an incomplete stream, got %v", resp.Events)
+	}
+
+	start := time.Now()
+	resp, err = request.DoStream(server, StreamConfig{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 3 || resp.Complete {
+		t.Errorf("expected 3 events from an incomplete stream, got %v", resp.Events)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected timeout to end the stream, took %v", d)
+	}
+}
+
+func TestStreamKeepsServerOrder(t *testing.T) {
+	var servers Servers
+	for _, delay := range []time.Duration{30, 0, 15} {
+		d := delay * time.Millisecond
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(d)
+			sseHandler([]string{d.String()}, false)(w, r)
+		}))
+		defer ts.Close()
+		servers = append(servers, NewServer(ts.URL, nil))
+	}
+
+	responses, err := servers.Stream(NewRequest("GET", "/", nil, nil), StreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, resp := range responses {
+		if "http://"+resp.Request.URL.Host != servers[i].BaseURI {
+			t.Errorf("response %d came from the wrong server: %v", i, resp.Events)
+		}
+	}
+}
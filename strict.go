@@ -0,0 +1,258 @@
+package congruent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StrictKind is the kind of difference found by BodyStrictJSONSame
+type StrictKind int
+
+const (
+	// StrictContent is a difference in the decoded content
+	StrictContent StrictKind = iota
+	// StrictKeyOrder is an object whose keys are in a different order
+	StrictKeyOrder
+	// StrictDuplicateKey is an object with the same key more than once
+	StrictDuplicateKey
+	// StrictTrailingNewline is a body which ends in a newline when the other
+	// doesn't
+	StrictTrailingNewline
+	// StrictByteOrderMark is a body which starts with a UTF-8 byte order mark
+	// when the other doesn't
+	StrictByteOrderMark
+	// StrictInvalid is a body which isn't JSON at all
+	StrictInvalid
+)
+
+func (k StrictKind) String() string {
+	switch k {
+	case StrictContent:
+		return "content"
+	case StrictKeyOrder:
+		return "key order"
+	case StrictDuplicateKey:
+		return "duplicate key"
+	case StrictTrailingNewline:
+		return "trailing newline"
+	case StrictByteOrderMark:
+		return "byte order mark"
+	case StrictInvalid:
+		return "invalid JSON"
+	}
+
+	return fmt.Sprintf("StrictKind(%d)", int(k))
+}
+
+// StrictJSONError is a difference found by BodyStrictJSONSame; Kind tells
+// which sort of difference it is.
+type StrictJSONError struct {
+	Kind    StrictKind
+	Method  string
+	URL     string
+	Message string
+}
+
+func (e *StrictJSONError) Error() string {
+	return fmt.Sprintf("(%s)%s: %s: %s", e.Method, e.URL, e.Kind, e.Message)
+}
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// keyOrder is the order keys were written in, in the object at a location
+type keyOrder struct {
+	at   []interface{}
+	keys []string
+}
+
+// jsonScan is what decoding leaves out: the order of keys, and any duplicates
+type jsonScan struct {
+	orders     []keyOrder
+	duplicates [][]interface{}
+}
+
+// scanJSON reads a document token by token, recording the order of the keys of
+// every object and the location of every duplicate key
+func scanJSON(b []byte) (*jsonScan, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	s := &jsonScan{}
+	if err := s.value(d, nil); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *jsonScan) value(d *json.Decoder, at []interface{}) error {
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		i := len(s.orders)
+		s.orders = append(s.orders, keyOrder{at: at})
+
+		seen := map[string]bool{}
+		for d.More() {
+			kt, err := d.Token()
+			if err != nil {
+				return err
+			}
+			k := kt.(string)
+
+			if seen[k] {
+				s.duplicates = append(s.duplicates, appendLocation(at, k))
+			} else {
+				seen[k] = true
+				s.orders[i].keys = append(s.orders[i].keys, k)
+			}
+
+			if err := s.value(d, appendLocation(at, k)); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token()
+	case json.Delim('['):
+		for i := 0; d.More(); i++ {
+			if err := s.value(d, appendLocation(at, i)); err != nil {
+				return err
+			}
+		}
+		_, err = d.Token()
+	}
+
+	return err
+}
+
+// BodyStrictJSONSame is a stricter BodyContentSame, for clients which depend
+// on more than the content of a JSON body. As well as the content, it checks
+// that objects list their keys in the same order, that no object has the same
+// key twice, which decoding would otherwise silently collapse, and that
+// either every body or none of them has a trailing newline, or starts with a
+// byte order mark. Returns a *StrictJSONError for the first difference, if
+// any. ContentOptions adjust the content comparison as for BodyContentSame;
+// IgnorePaths also skips key order and duplicates.
+func (r Responses) BodyStrictJSONSame(opts ...ContentOption) (err error) {
+	defer r.reproducible(&err)
+
+	c, err := newContentConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	type strictBody struct {
+		content interface{}
+		scan    *jsonScan
+		bom     bool
+		newline bool
+	}
+
+	bodies := make([]strictBody, len(r))
+	for i, resp := range r {
+		fail := func(kind StrictKind, format string, args ...interface{}) error {
+			return &StrictJSONError{
+				Kind:    kind,
+				Method:  resp.Request.Method,
+				URL:     resp.Request.URL.String(),
+				Message: fmt.Sprintf(format, args...),
+			}
+		}
+
+		b := resp.Body
+		sb := strictBody{bom: bytes.HasPrefix(b, utf8BOM), newline: bytes.HasSuffix(b, []byte("\n"))}
+		b = bytes.TrimPrefix(b, utf8BOM)
+
+		content, ok := decodeContent(b)
+		if !ok {
+			return fail(StrictInvalid, "body was not JSON\nReceived body: \n  %s", cutBody(resp.Body))
+		}
+		scan, err := scanJSON(b)
+		if err != nil {
+			return fail(StrictInvalid, "%v", err)
+		}
+		for _, at := range scan.duplicates {
+			if !c.ignored(at) {
+				return fail(StrictDuplicateKey, "%s appears more than once", formatLocation(at))
+			}
+		}
+		sb.content, sb.scan = content, scan
+		bodies[i] = sb
+
+		if i == 0 {
+			continue
+		}
+		prev := bodies[i-1]
+
+		if prev.bom != sb.bom {
+			return fail(StrictByteOrderMark, "expected %s, was %s", presence(prev.bom), presence(sb.bom))
+		}
+		if prev.newline != sb.newline {
+			return fail(StrictTrailingNewline, "expected %s, was %s", presence(prev.newline), presence(sb.newline))
+		}
+
+		if m := compareContent(c, nil, prev.content, sb.content); m != nil {
+			return fail(StrictContent, "%s\n%s", m, responsesDiff(c, r[i-1], resp, r[i-1].Body, resp.Body))
+		}
+
+		if at, expected, received, ok := compareKeyOrder(c, prev.scan, sb.scan); !ok {
+			return fail(StrictKeyOrder, "%s: expected keys in order %s, was %s",
+				formatLocation(at), strings.Join(expected, ", "), strings.Join(received, ", "))
+		}
+	}
+
+	return nil
+}
+
+func presence(present bool) string {
+	if present {
+		return "present"
+	}
+
+	return "absent"
+}
+
+// compareKeyOrder finds the first object whose keys, among those both sides
+// have, are in a different order; it reports false if there is one
+func compareKeyOrder(c *contentConfig, a, b *jsonScan) ([]interface{}, []string, []string, bool) {
+	orders := map[string][]string{}
+	for _, o := range b.orders {
+		orders[formatLocation(o.at)] = o.keys
+	}
+
+	common := func(keys, other []string) []string {
+		in := map[string]bool{}
+		for _, k := range other {
+			in[k] = true
+		}
+		var kept []string
+		for _, k := range keys {
+			if in[k] {
+				kept = append(kept, k)
+			}
+		}
+		return kept
+	}
+
+	for _, o := range a.orders {
+		if c.ignored(o.at) {
+			continue
+		}
+		other, ok := orders[formatLocation(o.at)]
+		if !ok {
+			continue
+		}
+
+		expected, received := common(o.keys, other), common(other, o.keys)
+		if strings.Join(expected, "\x00") != strings.Join(received, "\x00") {
+			return o.at, expected, received, false
+		}
+	}
+
+	return nil, nil, nil, true
+}
@@ -0,0 +1,62 @@
+package congruent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBodyStrictJSONSame(t *testing.T) {
+	same := [][2]string{
+		{`{"a":1,"b":{"c":[1,{"d":2,"e":3}]}}`, `{ "a": 1, "b": { "c": [1, {"d": 2, "e": 3}] } }`},
+		{"{\"a\":1}\n", "{\n  \"a\": 1\n}\n"},
+		{"\xef\xbb\xbf[1]", "\xef\xbb\xbf[ 1 ]"},
+	}
+	for _, c := range same {
+		if err := mockResponses(c[0], c[1]).BodyStrictJSONSame(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	cases := []struct {
+		a, b    string
+		kind    StrictKind
+		message string
+	}{
+		{`{"a":1,"b":2}`, `{"b":2,"a":1}`, StrictKeyOrder, "$: expected keys in order a, b, was b, a"},
+		{`{"x":{"a":1,"b":2}}`, `{"x":{"b":2,"a":1}}`, StrictKeyOrder, "$.x: expected keys in order a, b, was b, a"},
+		{`{"a":1,"b":2}`, `{"a":1,"b":2,"a":1}`, StrictDuplicateKey, "$.a appears more than once"},
+		{`{"a":1}`, "{\"a\":1}\n", StrictTrailingNewline, "expected absent, was present"},
+		{"\xef\xbb\xbf{\"a\":1}", `{"a":1}`, StrictByteOrderMark, "expected present, was absent"},
+		{`{"a":1}`, `{"a":2}`, StrictContent, "$.a: expected 1, was 2"},
+		{`{"a":1}`, `{"a":1`, StrictInvalid, "body was not JSON"},
+	}
+
+	for _, c := range cases {
+		err := mockResponses(c.a, c.b).BodyStrictJSONSame()
+		if err == nil {
+			t.Errorf("%q vs %q: Expected error, but got none!", c.a, c.b)
+			continue
+		}
+
+		var se *StrictJSONError
+		if !errors.As(err, &se) {
+			t.Errorf("expected a *StrictJSONError, got %T", err)
+			continue
+		}
+		if se.Kind != c.kind || !strings.HasPrefix(se.Message, c.message) {
+			t.Errorf("%q vs %q: expected %s %q, got %s %q", c.a, c.b, c.kind, c.message, se.Kind, se.Message)
+		}
+		if !strings.HasPrefix(err.Error(), "(GET)http://server1/: "+c.kind.String()) {
+			t.Errorf("Did not get expected error string, got: %v", err)
+		}
+	}
+
+	// content is still compared loosely, by BodyContentSame's rules
+	if err := mockResponses(`{"a":1}`, `{"a":1,"b":2}`).BodyStrictJSONSame(IgnorePaths("$.b")); err != nil {
+		t.Error(err)
+	}
+	if err := mockResponses(`{"a":1,"a":2}`, `{"a":2}`).BodyStrictJSONSame(IgnorePaths("$.a")); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"sort"
 )
 
 // BasicAuth creates an authentication string suitable for use in a header
@@ -31,3 +32,13 @@ func mergeHTTPHeaders(dest *http.Header, headers ...*http.Header) {
 		}
 	}
 }
+
+func sortedHeaderKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,502 @@
+package congruent
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fardog/congruent/urljoin"
+)
+
+// DefaultWebSocketTimeout is how long a WebSocketScenario waits for each reply
+// when it doesn't set a Timeout of its own.
+const DefaultWebSocketTimeout = 5 * time.Second
+
+// DefaultWebSocketMaxMessageSize is the largest message a WebSocketScenario
+// accepts when it doesn't set a MaxMessageSize of its own.
+const DefaultWebSocketMaxMessageSize = 32 << 20
+
+// websocketGUID is the fixed value used to compute `Sec-WebSocket-Accept`,
+// from RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// WebSocketStep is a single message sent during a WebSocketScenario. Send is
+// prepared the same way as a Request body, except that a `[]byte` is sent
+// as-is in a binary message, and nil sends nothing, which is useful to wait for
+// a greeting. After sending, Replies messages are collected; when Replies is
+// zero, everything that arrives before the timeout is.
+type WebSocketStep struct {
+	Send    interface{}
+	Replies int
+}
+
+// NewWebSocketScenario creates a new WebSocket scenario to be run against a
+// Server
+func NewWebSocketScenario(p string, h *http.Header, steps ...WebSocketStep) *WebSocketScenario {
+	return &WebSocketScenario{Path: p, Headers: h, Steps: steps}
+}
+
+// WebSocketScenario represents a scripted WebSocket conversation. Timeout is
+// how long to wait for each reply; if it passes, the step is considered done
+// with however many replies had arrived, unless a message was partway through
+// arriving, which ends the scenario with an error. A message larger than
+// MaxMessageSize bytes is also an error.
+type WebSocketScenario struct {
+	Path           string
+	Headers        *http.Header
+	Steps          []WebSocketStep
+	Timeout        time.Duration
+	MaxMessageSize int
+}
+
+// WebSocketMessage is a single message received during a WebSocketScenario,
+// along with the index of the step that it followed
+type WebSocketMessage struct {
+	Step   int
+	Binary bool
+	Data   []byte
+}
+
+// WebSocketResponse represents a WebSocket conversation with a server; Request
+// and Headers are those of the opening handshake. Closed is whether the server
+// closed the connection before the scenario was over, and ClosedStep the index
+// of the step it did so during.
+type WebSocketResponse struct {
+	Request    *http.Request
+	Headers    *http.Header
+	Messages   []WebSocketMessage
+	Closed     bool
+	ClosedStep int
+}
+
+// WebSocketResponses is an array of WebSocketResponse pointers
+type WebSocketResponses []*WebSocketResponse
+
+// Do connects to a Server, runs each step of the scenario in turn, and returns
+// the messages received. If the server closes the connection, the remaining
+// steps are skipped.
+func (sc WebSocketScenario) Do(s *Server) (*WebSocketResponse, error) {
+	timeout := sc.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebSocketTimeout
+	}
+	limit := sc.MaxMessageSize
+	if limit <= 0 {
+		limit = DefaultWebSocketMaxMessageSize
+	}
+
+	conn, br, resp, err := sc.dial(s, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	fail := func(err error) (*WebSocketResponse, error) {
+		return nil, fmt.Errorf("(%s)%s: %v", resp.Request.Method, resp.Request.URL, err)
+	}
+
+	for i, step := range sc.Steps {
+		if step.Send != nil {
+			op, payload, err := prepareMessage(step.Send)
+			if err != nil {
+				return fail(err)
+			}
+
+			if err := writeFrame(conn, op, payload, true); err != nil {
+				return fail(err)
+			}
+		}
+
+		for n := 0; step.Replies <= 0 || n < step.Replies; n++ {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+
+			op, data, err := readMessage(br, conn, limit)
+			var ne net.Error
+			if err == io.EOF {
+				// readMessage has already answered a close frame
+				resp.Closed, resp.ClosedStep = true, i
+				return resp, nil
+			} else if errors.As(err, &ne) && ne.Timeout() {
+				break
+			} else if err != nil {
+				return fail(err)
+			}
+
+			resp.Messages = append(resp.Messages, WebSocketMessage{i, op == opBinary, data})
+		}
+	}
+
+	writeFrame(conn, opClose, []byte{0x03, 0xe8}, true)
+
+	return resp, nil
+}
+
+// WebSocket runs a scenario against a list of servers, and returns the
+// messages received from each, in the same order as the servers
+func (s Servers) WebSocket(sc *WebSocketScenario) (WebSocketResponses, error) {
+	responses := make(WebSocketResponses, len(s))
+	err := s.each(func(i int, server *Server) (err error) {
+		responses[i], err = sc.Do(server)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
+
+// dial opens a connection to a Server and performs the opening handshake
+func (sc WebSocketScenario) dial(s *Server, timeout time.Duration) (net.Conn, *bufio.Reader, *WebSocketResponse, error) {
+	u, err := url.Parse(urljoin.Join(s.BaseURI + sc.Path))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	secure := false
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "http"
+	case "https", "wss":
+		u.Scheme, secure = "https", true
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported WebSocket scheme %q", u.Scheme)
+	}
+
+	// the handshake goes through the Server's middleware like any other request
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mergeHTTPHeaders(&req.Header, s.Headers, sc.Headers)
+	if err := s.rewrite(req); err != nil {
+		return nil, nil, nil, err
+	}
+	u = req.URL
+
+	addr := u.Host
+	if u.Port() == "" {
+		if secure {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf(
+			"(%s)%s: Status was %d, expected %d",
+			req.Method, req.URL, resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != acceptKey(key) {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf(
+			"(%s)%s: Invalid Sec-WebSocket-Accept %q", req.Method, req.URL, accept)
+	}
+
+	return conn, br, &WebSocketResponse{Request: req, Headers: &resp.Header}, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func prepareMessage(v interface{}) (byte, []byte, error) {
+	if b, ok := v.([]byte); ok {
+		return opBinary, b, nil
+	}
+
+	buf, err := Request{Body: v}.PrepareBody()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return opText, buf.Bytes(), nil
+}
+
+// writeFrame writes a single, unfragmented frame; clients must mask every
+// frame they send, and servers must not
+func writeFrame(w io.Writer, op byte, payload []byte, mask bool) error {
+	header := []byte{0x80 | op, 0}
+
+	switch l := len(payload); {
+	case l < 126:
+		header[1] = byte(l)
+	case l <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(l))
+	default:
+		header[1] = 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(l))
+	}
+
+	if mask {
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		header[1] |= 0x80
+		header = append(header, key...)
+
+		masked := make([]byte, len(payload))
+		for i, c := range payload {
+			masked[i] = c ^ key[i%4]
+		}
+		payload = masked
+	}
+
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// readFrame reads a single frame, unmasking its payload if needed; a payload
+// of more than limit bytes is an error
+func readFrame(r io.Reader, limit int) (fin bool, op byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+
+	fin, op = header[0]&0x80 != 0, header[0]&0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if length > uint64(limit) {
+		err = fmt.Errorf("WebSocket frame of %d bytes is larger than the limit of %d", length, limit)
+		return
+	}
+
+	var key []byte
+	if masked {
+		key = make([]byte, 4)
+		if _, err = io.ReadFull(r, key); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+
+	return
+}
+
+// readMessage reads frames until a complete data message of at most limit
+// bytes has arrived, answering pings along the way; a close frame is reported
+// as io.EOF. An error partway through a frame or a fragmented message leaves
+// the connection out of step, so is reported as errPartialMessage.
+func readMessage(r io.Reader, w io.Writer, limit int) (byte, []byte, error) {
+	var op byte
+	var data []byte
+	cr := &countingReader{r: r}
+
+	for {
+		start := cr.n
+		fin, fop, payload, err := readFrame(cr, limit)
+		if err != nil {
+			if cr.n > start || op != 0 {
+				return 0, nil, fmt.Errorf("%w: %v", errPartialMessage, err)
+			}
+			return 0, nil, err
+		}
+
+		switch fop {
+		case opPing:
+			if err := writeFrame(w, opPong, payload, true); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			writeFrame(w, opClose, payload, true)
+			return 0, nil, io.EOF
+		case opText, opBinary:
+			op = fop
+		case opContinuation:
+		default:
+			return 0, nil, fmt.Errorf("unknown WebSocket opcode %#x", fop)
+		}
+
+		if len(data)+len(payload) > limit {
+			return 0, nil, fmt.Errorf("WebSocket message is larger than the limit of %d bytes", limit)
+		}
+		data = append(data, payload...)
+		if fin {
+			return op, data, nil
+		}
+	}
+}
+
+// errPartialMessage is returned by readMessage when the connection stops
+// partway through a message
+var errPartialMessage = errors.New("connection stopped partway through a message")
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// closedDescription describes when a server closed the connection
+func closedDescription(r *WebSocketResponse) string {
+	if !r.Closed {
+		return "left open"
+	}
+
+	return fmt.Sprintf("closed during step %d", r.ClosedStep)
+}
+
+// MessagesSame verifies that every server sent the same sequence of messages,
+// following the same steps; returns an error for the first mismatch, if not.
+func (r WebSocketResponses) MessagesSame() error {
+	return r.messagesEqual(func(a, b []byte) ([]byte, []byte, bool) {
+		return a, b, bytesEqual(a, b)
+	})
+}
+
+// MessagesContentSame is as MessagesSame, but compares text messages the way
+// BodyContentSame compares bodies, ignoring JSON formatting.
+func (r WebSocketResponses) MessagesContentSame() error {
+	return r.messagesEqual(func(a, b []byte) ([]byte, []byte, bool) {
+		return a, b, contentEqual(a, b)
+	})
+}
+
+func (r WebSocketResponses) messagesEqual(dataEqual func(a, b []byte) ([]byte, []byte, bool)) error {
+	if len(r) < 2 {
+		return nil
+	}
+
+	for i, resp := range r[1:] {
+		prev := r[i]
+		method, url := resp.Request.Method, resp.Request.URL
+
+		if prev.Closed != resp.Closed || prev.Closed && prev.ClosedStep != resp.ClosedStep {
+			return fmt.Errorf(
+				"(%s)%s: Connection was %s, expected it to be %s",
+				method, url, closedDescription(resp), closedDescription(prev))
+		}
+
+		if lp, lr := len(prev.Messages), len(resp.Messages); lp != lr {
+			return fmt.Errorf(
+				"(%s)%s: Received %d messages, expected %d", method, url, lr, lp)
+		}
+
+		for j, m := range resp.Messages {
+			pm := prev.Messages[j]
+			if m.Step != pm.Step {
+				return fmt.Errorf(
+					"(%s)%s: Expected message %d to follow step %d, followed %d",
+					method, url, j, pm.Step, m.Step)
+			}
+			if m.Binary != pm.Binary {
+				return fmt.Errorf(
+					"(%s)%s: Expected message %d to have binary %v, was %v",
+					method, url, j, pm.Binary, m.Binary)
+			}
+
+			equal := dataEqual
+			if m.Binary {
+				equal = func(a, b []byte) ([]byte, []byte, bool) {
+					return a, b, bytesEqual(a, b)
+				}
+			}
+			if a, b, ok := equal(pm.Data, m.Data); !ok {
+				return fmt.Errorf(
+					"(%s)%s: message %d:\nExpected data:\n  %s\nReceived data: \n  %s",
+					method, url, j, cutBody(a), cutBody(b))
+			}
+		}
+	}
+
+	return nil
+}
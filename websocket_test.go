@@ -0,0 +1,343 @@
+package congruent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClose, as a reply, has the test server close the connection
+const wsClose = "\x00close"
+
+// wsServer upgrades each connection and passes every text message received to
+// reply, sending back whatever messages it returns
+func wsServer(t *testing.T, reply func(msg string) []string) *httptest.Server {
+	return httptest.NewServer(wsHandler(t, reply))
+}
+
+func wsHandler(t *testing.T, reply func(msg string) []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		brw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		brw.Flush()
+
+		for {
+			_, op, payload, err := readFrame(brw, DefaultWebSocketMaxMessageSize)
+			if err != nil || op == opClose {
+				return
+			}
+
+			for _, m := range reply(string(payload)) {
+				if m == wsClose {
+					writeFrame(conn, opClose, []byte{0x03, 0xe8}, false)
+					continue
+				}
+				if err := writeFrame(conn, opText, []byte(m), false); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, l := range []int{0, 125, 126, 70000} {
+		payload := bytes.Repeat([]byte{'x'}, l)
+
+		var buf bytes.Buffer
+		if err := writeFrame(&buf, opBinary, payload, true); err != nil {
+			t.Fatal(err)
+		}
+
+		fin, op, got, err := readFrame(&buf, DefaultWebSocketMaxMessageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fin || op != opBinary || !bytes.Equal(got, payload) {
+			t.Errorf("length %d: frame did not round trip", l)
+		}
+	}
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	var in, out bytes.Buffer
+	in.Write([]byte{0x01, 3, 'a', 'b', 'c'})
+	writeFrame(&in, opPing, []byte("hi"), false)
+	in.Write([]byte{0x80, 3, 'd', 'e', 'f'})
+
+	op, data, err := readMessage(&in, &out, DefaultWebSocketMaxMessageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != opText || string(data) != "abcdef" {
+		t.Errorf("unexpected message %x %s", op, data)
+	}
+
+	_, pop, pong, err := readFrame(&out, DefaultWebSocketMaxMessageSize)
+	if err != nil || pop != opPong || string(pong) != "hi" {
+		t.Errorf("expected pong in reply to ping, got %x %s %v", pop, pong, err)
+	}
+}
+
+func TestReadFrameLimit(t *testing.T) {
+	// a length which would panic, or exhaust memory, if it were allocated
+	huge := []byte{0x82, 127, 0x40, 0, 0, 0, 0, 0, 0, 0}
+	if _, _, _, err := readFrame(bytes.NewReader(huge), DefaultWebSocketMaxMessageSize); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "larger than the limit") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+
+	// fragments which are each small enough, but not together
+	var out bytes.Buffer
+	in := []byte{0x01, 3, 'a', 'b', 'c', 0x80, 3, 'd', 'e', 'f'}
+	if _, _, err := readMessage(bytes.NewReader(in), &out, 4); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+}
+
+func TestReadMessagePartial(t *testing.T) {
+	var out bytes.Buffer
+	for _, b := range [][]byte{
+		{0x81, 10, 'a', 'b'},
+		{0x01, 1, 'a'},
+		{0x81},
+	} {
+		_, _, err := readMessage(bytes.NewReader(b), &out, DefaultWebSocketMaxMessageSize)
+		if !errors.Is(err, errPartialMessage) {
+			t.Errorf("%v: expected a partial message, got %v", b, err)
+		}
+	}
+
+	// nothing at all is not partial
+	if _, _, err := readMessage(bytes.NewReader(nil), &out, DefaultWebSocketMaxMessageSize); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestWebSocketPartialFrame(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		brw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		brw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		// the start of a ten byte frame, and then nothing
+		brw.Write([]byte{0x81, 10, 'a', 'b'})
+		brw.Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	scenario := NewWebSocketScenario("/", nil, WebSocketStep{Replies: 1}, WebSocketStep{Send: "next", Replies: 1})
+	scenario.Timeout = 50 * time.Millisecond
+	if _, err := scenario.Do(NewServer(ts.URL, nil)); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "partway through a message") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ts0 := wsServer(t, func(msg string) []string {
+		return []string{msg, `{"ok":true,"n":1.5}`}
+	})
+	defer ts0.Close()
+	ts1 := wsServer(t, func(msg string) []string {
+		return []string{msg, `{ "ok": true, "n": 1.50 }`}
+	})
+	defer ts1.Close()
+	ts2 := wsServer(t, func(msg string) []string {
+		return []string{strings.ToUpper(msg)}
+	})
+	defer ts2.Close()
+
+	scenario := NewWebSocketScenario("/", nil,
+		WebSocketStep{Send: "hello", Replies: 2},
+		WebSocketStep{Send: map[string]int{"n": 1}, Replies: 2})
+	scenario.Timeout = time.Second
+
+	servers := Servers{NewServer(ts0.URL, nil), NewServer(ts1.URL, nil)}
+	responses, err := servers.WebSocket(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(responses[0].Messages); l != 4 {
+		t.Errorf("expected 4 messages, got %d", l)
+	}
+	if err := responses.MessagesContentSame(); err != nil {
+		t.Error(err)
+	}
+	if err := responses.MessagesSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	}
+
+	scenario.Timeout = 100 * time.Millisecond
+	servers = Servers{NewServer(ts0.URL, nil), NewServer(ts2.URL, nil)}
+	responses, err = servers.WebSocket(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.MessagesContentSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "messages") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestWebSocketRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	scenario := NewWebSocketScenario("/", nil, WebSocketStep{Send: "hello"})
+	if _, err := scenario.Do(NewServer(ts.URL, nil)); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "403") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestWebSocketKeepsServerOrder(t *testing.T) {
+	var servers Servers
+	for _, delay := range []time.Duration{30, 0, 15} {
+		d := delay * time.Millisecond
+		ts := wsServer(t, func(msg string) []string {
+			time.Sleep(d)
+			return []string{d.String()}
+		})
+		defer ts.Close()
+		servers = append(servers, NewServer(ts.URL, nil))
+	}
+
+	scenario := NewWebSocketScenario("/", nil, WebSocketStep{Send: "hello", Replies: 1})
+	scenario.Timeout = time.Second
+	responses, err := servers.WebSocket(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, resp := range responses {
+		if "http://"+resp.Request.URL.Host != servers[i].BaseURI {
+			t.Errorf("response %d came from the wrong server: %v", i, resp.Messages)
+		}
+	}
+}
+
+func TestWebSocketMiddleware(t *testing.T) {
+	echo := wsHandler(t, func(msg string) []string { return []string{msg} })
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/chat" || r.Header.Get("Authorization") != "k" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		echo.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	server := &Server{
+		BaseURI:    ts.URL,
+		Middleware: []Middleware{RewritePath("/v1/", "/v2/"), RenameHeader("X-Api-Key", "Authorization")},
+	}
+	scenario := NewWebSocketScenario("/v1/chat", &http.Header{"X-Api-Key": {"k"}}, WebSocketStep{Send: "hello", Replies: 1})
+	scenario.Timeout = time.Second
+
+	resp, err := scenario.Do(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Request.URL.Path != "/v2/chat" || len(resp.Messages) != 1 {
+		t.Errorf("unexpected response %s %v", resp.Request.URL, resp.Messages)
+	}
+
+	server.Middleware = []Middleware{func(req *http.Request) error { return fmt.Errorf("bad request") }}
+	if _, err := scenario.Do(server); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if err.Error() != "(GET)"+ts.URL+"/v1/chat: bad request" {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestWebSocketServerCloses(t *testing.T) {
+	var received []string
+	closing := wsServer(t, func(msg string) []string {
+		received = append(received, msg)
+		if msg == "bye" {
+			return []string{"ok", wsClose}
+		}
+		return []string{msg}
+	})
+	defer closing.Close()
+	open := wsServer(t, func(msg string) []string {
+		if msg == "bye" {
+			return []string{"ok"}
+		}
+		return []string{msg}
+	})
+	defer open.Close()
+
+	scenario := NewWebSocketScenario("/", nil,
+		WebSocketStep{Send: "hi", Replies: 1},
+		WebSocketStep{Send: "bye"},
+		WebSocketStep{Send: "after", Replies: 1},
+	)
+	scenario.Timeout = 100 * time.Millisecond
+
+	resp, err := scenario.Do(NewServer(closing.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Closed || resp.ClosedStep != 1 || len(resp.Messages) != 2 {
+		t.Errorf("expected 2 messages and a close during step 1, got %v %d %v", resp.Closed, resp.ClosedStep, resp.Messages)
+	}
+	if strings.Join(received, ",") != "hi,bye" {
+		t.Errorf("expected nothing to be sent after the close, got %v", received)
+	}
+
+	responses, err := Servers{NewServer(open.URL, nil), NewServer(closing.URL, nil)}.WebSocket(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responses.MessagesSame(); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.Contains(err.Error(), "Connection was closed during step 1, expected it to be left open") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}
+
+func TestWebSocketBadMessage(t *testing.T) {
+	ts := wsServer(t, func(msg string) []string { return nil })
+	defer ts.Close()
+
+	scenario := NewWebSocketScenario("/", nil, WebSocketStep{Send: func() {}})
+	if _, err := scenario.Do(NewServer(ts.URL, nil)); err == nil {
+		t.Error("Expected error, but got none!")
+	} else if !strings.HasPrefix(err.Error(), "(GET)"+ts.URL+"/: ") {
+		t.Errorf("Did not get expected error string, got: %v", err)
+	}
+}